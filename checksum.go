@@ -0,0 +1,50 @@
+package worldDataFormat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// frames with HasChecksumFlag end their data with the CRC32-C of the data before it
+const checksumSize = 4
+
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+func writeChecksum(target io.Writer, data []byte) error {
+	var checksum [checksumSize]byte
+	binary.LittleEndian.PutUint32(checksum[:], crc32.Checksum(data, checksumTable))
+	_, err := target.Write(checksum[:])
+	return err
+}
+
+// data read with HasChecksumFlag without its checksum, a ChecksumError outside any set if it does not match
+func verifyChecksum(data []byte, frameType uint64) ([]byte, error) {
+	if len(data) < checksumSize {
+		return nil, InvalidData
+	}
+	var stored = binary.LittleEndian.Uint32(data[len(data)-checksumSize:])
+	data = data[: len(data)-checksumSize : len(data)-checksumSize]
+	if crc32.Checksum(data, checksumTable) != stored {
+		return nil, &ChecksumError{FrameSet: -1, Frame: -1, FrameType: frameType}
+	}
+	return data, nil
+}
+
+// CRC32-C of a type block written in parts, stored in the set header with HasBlockChecksumsFlag
+func blockChecksum(parts []bytes.Buffer) uint32 {
+	var checksum uint32
+	for index := range parts {
+		checksum = crc32.Update(checksum, checksumTable, parts[index].Bytes())
+	}
+	return checksum
+}
+
+// a ChecksumError for the whole block outside any set if it does not match checksum
+func verifyBlockChecksum(block []byte, checksum uint32, frameType uint64) error {
+	if crc32.Checksum(block, checksumTable) != checksum {
+		return &ChecksumError{FrameSet: -1, Frame: -1, FrameType: frameType}
+	}
+	return nil
+}
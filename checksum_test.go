@@ -0,0 +1,174 @@
+package worldDataFormat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	. "github.com/Smerom/WorldDataFormat"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checksums", func() {
+	var values = [][]float64{{100, -200, 300, 4}, {101, -198, 299, 5}, {102, -196, 298, 6}}
+
+	// two sets of three frames each
+	write := func(isChecksummed bool, isCompressed bool, typesToWrite uint64) []byte {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		sim.SetSelfDiffed(true)
+		sim.SetChecksummed(isChecksummed)
+		for s := 0; s < 2; s++ {
+			var set FrameSet
+			for _, frameValues := range values {
+				var elevations ElevationFrame
+				elevations.SetElevations(frameValues)
+				var satallite SatalliteFrame
+				satallite.SetColorsFromData(frameValues, frameValues, frameValues, nil)
+				set.AddFrame(Frame{Age: &AgeFrame{Age: frameValues[0]}, Elevations: &elevations, Satallite: &satallite})
+			}
+			sim.AddFrameSet(set)
+		}
+		var data bytes.Buffer
+		Expect(sim.WriteRendered(&data, isCompressed, typesToWrite)).To(Succeed())
+		return data.Bytes()
+	}
+
+	// transcoding may repack both sets into one
+	expectValues := func(readSim WorldSimulation) {
+		var frameCount int
+		for _, set := range readSim.FrameSets() {
+			for _, frame := range set.Frames() {
+				Expect(frame.Elevations.ApproximateElevations()).To(Equal(values[frameCount%len(values)]))
+				frameCount++
+			}
+		}
+		Expect(frameCount).To(Equal(2 * len(values)))
+	}
+
+	for _, isCompressed := range []bool{false, true} {
+		isCompressed := isCompressed
+
+		It(fmt.Sprintf("should round trip, compressed: %t", isCompressed), func() {
+			readSim, err := ReadWorldSimulation(bytes.NewReader(write(true, isCompressed, ElevationFrameFlag|SatalliteFrameFlag)))
+			Expect(err).ToNot(HaveOccurred())
+			expectValues(readSim)
+			for _, frame := range readSim.FrameSets()[1].Frames() {
+				Expect(frame.Satallite.Colors()).To(HaveLen(4))
+			}
+		})
+
+		for _, frameType := range []uint64{ElevationFrameFlag, SatalliteFrameFlag} {
+			frameType := frameType
+
+			It(fmt.Sprintf("should name the corrupted frame, compressed: %t, type: %d", isCompressed, frameType), func() {
+				data := write(true, isCompressed, frameType)
+				// the last data byte of the last frame, before its checksum
+				data[len(data)-5] ^= 0x10
+
+				_, err := ReadWorldSimulation(bytes.NewReader(data))
+				Expect(err).To(Equal(&ChecksumError{FrameSet: 1, Frame: 2, FrameType: frameType}))
+			})
+		}
+	}
+
+	It("should add a checksum to each frame and block", func() {
+		plain := write(false, false, ElevationFrameFlag)
+		checksummed := write(true, false, ElevationFrameFlag)
+		// each set header gains its flags and the checksum of its one block
+		Expect(len(checksummed) - len(plain)).To(Equal(2*len(values)*4 + 2*(8+4)))
+	})
+
+	It("should check blocks without storage flags with the set", func() {
+		data := write(true, false, AgeFrameFlag|ElevationFrameFlag)
+		readSim, err := ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readSim.FrameSets()[1].Frames()[2].Age.Age).To(Equal(values[2][0]))
+
+		// the last age of the second set, blocks are stored in bit order, so it ends just before the elevations
+		setStart := 40 + int(binary.LittleEndian.Uint64(data[40:]))
+		elevationOffset := int(binary.LittleEndian.Uint64(data[setStart+32+8:]))
+		data[setStart+24+8+16+8+4+4+elevationOffset-1] ^= 0x10
+		_, err = ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).To(Equal(&ChecksumError{FrameSet: 1, Frame: -1, FrameType: AgeFrameFlag}))
+
+		// nor are they checked without it
+		data = write(false, false, AgeFrameFlag|ElevationFrameFlag)
+		setStart = 40 + int(binary.LittleEndian.Uint64(data[40:]))
+		elevationOffset = int(binary.LittleEndian.Uint64(data[setStart+32+8:]))
+		data[setStart+24+8+16+elevationOffset-1] ^= 0x10
+		readSim, err = ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readSim.FrameSets()[1].Frames()[2].Age.Age).ToNot(Equal(values[2][0]))
+	})
+
+	It("should check and keep block checksums when upgrading", func() {
+		data := write(true, false, AgeFrameFlag|ElevationFrameFlag)
+		var upgraded bytes.Buffer
+		Expect(Upgrade(bytes.NewReader(data), &upgraded)).To(Succeed())
+		// past the file header, whose count is unknown when the target cannot seek
+		Expect(upgraded.Bytes()[40:]).To(Equal(data[40:]))
+
+		// the first age of the first set
+		data[40+24+8+16+8+4+4] ^= 0x10
+		upgraded.Reset()
+		Expect(Upgrade(bytes.NewReader(data), &upgraded)).To(Equal(&ChecksumError{FrameSet: 0, Frame: -1, FrameType: AgeFrameFlag}))
+	})
+
+	It("should name the basis of an average diffed set", func() {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		sim.SetAverageDiffed(true)
+		sim.SetChecksummed(true)
+		var set FrameSet
+		for _, frameValues := range values {
+			var elevations ElevationFrame
+			elevations.SetElevations(frameValues)
+			set.AddFrame(Frame{Elevations: &elevations})
+		}
+		sim.AddFrameSet(set)
+		var data bytes.Buffer
+		Expect(sim.WriteRendered(&data, false, ElevationFrameFlag)).To(Succeed())
+
+		// the basis is the first record, after the file header, set header with its block checksum and its frame header
+		data.Bytes()[40+40+12+64] ^= 0x01
+		_, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+		Expect(err).To(Equal(&ChecksumError{FrameSet: 0, Frame: -1, FrameType: ElevationFrameFlag}))
+	})
+
+	It("should add or drop checksums when transcoding", func() {
+		data := write(true, true, ElevationFrameFlag)
+
+		var dropped bytes.Buffer
+		var transcoder WorldSimulation
+		transcoder.SetSelfDiffed(true)
+		Expect(transcoder.ReadToWriter(bytes.NewReader(data), &dropped, false, true, ElevationFrameFlag)).To(Succeed())
+		readSim, err := ReadWorldSimulation(bytes.NewReader(dropped.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		expectValues(readSim)
+
+		var added bytes.Buffer
+		transcoder = WorldSimulation{}
+		transcoder.SetSelfDiffed(true)
+		transcoder.SetChecksummed(true)
+		Expect(transcoder.ReadToWriter(bytes.NewReader(dropped.Bytes()), &added, false, true, ElevationFrameFlag)).To(Succeed())
+		readSim, err = ReadWorldSimulation(bytes.NewReader(added.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(added.Len() - dropped.Len()).To(Equal(2*len(values)*4 + len(readSim.FrameSets())*(8+4)))
+		expectValues(readSim)
+	})
+
+	It("should report the set when reading by index", func() {
+		data := write(true, false, ElevationFrameFlag)
+		data[len(data)-5] ^= 0x10
+
+		index, err := BuildSimulationIndex(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = index.ReadFrameSet(0)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = index.ReadFrameSet(1)
+		Expect(err).To(Equal(&ChecksumError{FrameSet: 1, Frame: 2, FrameType: ElevationFrameFlag}))
+	})
+})
@@ -0,0 +1,170 @@
+package worldDataFormat
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// codecs for compressed frame data, stored in the StorageFlags bits of CompressionCodecMask
+const (
+	GzipCodec    = 0 // files written before codecs were recorded are all gzip
+	DeflateCodec = 1
+	ZlibCodec    = 2
+	LZWCodec     = 3 // level is ignored
+
+	FirstUserCodec = 8 // ids from here to MaxCodec are free for RegisterCompressionCodec
+	MaxCodec       = CompressionCodecMask >> CompressionCodecShift
+)
+
+type CompressionCodec interface {
+	NewWriter(target io.Writer, level int) (io.WriteCloser, error)
+	NewReader(source io.Reader) (io.ReadCloser, error)
+}
+
+// codec and level used when writing compressed frames
+type Compression struct {
+	Codec uint64
+	Level int
+}
+
+// used unless SetCompression is called
+var DefaultCompression = Compression{Codec: GzipCodec, Level: gzip.BestCompression}
+
+var codecLock sync.RWMutex
+var codecs = map[uint64]CompressionCodec{
+	GzipCodec:    gzipCodec{},
+	DeflateCodec: deflateCodec{},
+	ZlibCodec:    zlibCodec{},
+	LZWCodec:     lzwCodec{},
+}
+
+// makes codec available for reading and writing frames under id, which must be from FirstUserCodec to MaxCodec
+func RegisterCompressionCodec(id uint64, codec CompressionCodec) error {
+	if id < FirstUserCodec || id > MaxCodec || codec == nil {
+		return InvalidOptions
+	}
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	codecs[id] = codec
+	return nil
+}
+
+func lookupCodec(id uint64) (CompressionCodec, error) {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	codec, ok := codecs[id]
+	if !ok {
+		return nil, UnknownCodec
+	}
+	return codec, nil
+}
+
+// storage flags recording that data was compressed with compression
+func (compression Compression) storageFlags() uint64 {
+	return IsCompressedFlag | (compression.Codec << CompressionCodecShift & CompressionCodecMask)
+}
+
+// codec recorded in storage flags
+func codecFromFlags(flags uint64) uint64 {
+	return (flags & CompressionCodecMask) >> CompressionCodecShift
+}
+
+func compressData(data []byte, compression Compression) ([]byte, error) {
+	codec, err := lookupCodec(compression.Codec)
+	if err != nil {
+		return nil, err
+	}
+	var finalizedBuffer bytes.Buffer
+	writer, err := codec.NewWriter(&finalizedBuffer, compression.Level)
+	if err != nil {
+		return nil, err
+	}
+	_, err = writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return finalizedBuffer.Bytes(), nil
+}
+
+func decompressData(data []byte, codecID uint64) ([]byte, error) {
+	codec, err := lookupCodec(codecID)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := codec.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+// converts data as stored in a read frame to how encoding stores it, leaving it untouched where possible
+func convertStoredData(data []byte, isFromCompressed bool, fromCodec uint64, encoding frameEncoding) ([]byte, error) {
+	if isFromCompressed == encoding.isCompressed && (!isFromCompressed || fromCodec == encoding.compression.Codec) {
+		return data, nil
+	}
+	var err error
+	var raw = data
+	if isFromCompressed {
+		raw, err = decompressData(data, fromCodec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if encoding.isCompressed {
+		return compressData(raw, encoding.compression)
+	}
+	return raw, nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) NewWriter(target io.Writer, level int) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(target, level)
+}
+
+func (gzipCodec) NewReader(source io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(source)
+}
+
+type deflateCodec struct{}
+
+func (deflateCodec) NewWriter(target io.Writer, level int) (io.WriteCloser, error) {
+	return flate.NewWriter(target, level)
+}
+
+func (deflateCodec) NewReader(source io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(source), nil
+}
+
+type zlibCodec struct{}
+
+func (zlibCodec) NewWriter(target io.Writer, level int) (io.WriteCloser, error) {
+	return zlib.NewWriterLevel(target, level)
+}
+
+func (zlibCodec) NewReader(source io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(source)
+}
+
+type lzwCodec struct{}
+
+func (lzwCodec) NewWriter(target io.Writer, level int) (io.WriteCloser, error) {
+	return lzw.NewWriter(target, lzw.LSB, 8), nil
+}
+
+func (lzwCodec) NewReader(source io.Reader) (io.ReadCloser, error) {
+	return lzw.NewReader(source, lzw.LSB, 8), nil
+}
@@ -0,0 +1,112 @@
+package worldDataFormat_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	. "github.com/Smerom/WorldDataFormat"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// stores data uncompressed, counting uses
+type countingCodec struct {
+	writers *int
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func (codec countingCodec) NewWriter(target io.Writer, level int) (io.WriteCloser, error) {
+	*codec.writers++
+	return nopWriteCloser{target}, nil
+}
+
+func (codec countingCodec) NewReader(source io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(source), nil
+}
+
+var _ = Describe("Compression", func() {
+	var worldSim WorldSimulation
+
+	BeforeEach(func() {
+		worldSim = WorldSimulation{}
+		worldSim.SetSubdivisions(2)
+		var set FrameSet
+		for f := 0; f < 3; f++ {
+			var elevations ElevationFrame
+			elevations.SetElevations([]float64{100, float64(f * 10), -50})
+			set.AddFrame(Frame{Elevations: &elevations})
+		}
+		worldSim.AddFrameSet(set)
+	})
+
+	readRendered := func(data []byte) [][]int16 {
+		readSim, err := ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		var rendered [][]int16
+		for _, frame := range readSim.FrameSets()[0].Frames() {
+			Expect(frame.Elevations.Decode()).To(Succeed())
+			rendered = append(rendered, frame.Elevations.RenderedElevations())
+		}
+		return rendered
+	}
+	expected := [][]int16{{100, 0, -50}, {100, 10, -50}, {100, 20, -50}}
+
+	for _, compression := range []Compression{
+		{Codec: GzipCodec, Level: flate.BestSpeed},
+		{Codec: DeflateCodec, Level: flate.BestCompression},
+		{Codec: ZlibCodec, Level: flate.DefaultCompression},
+		{Codec: LZWCodec},
+	} {
+		compression := compression
+
+		It(fmt.Sprintf("should read back frames written with codec %d", compression.Codec), func() {
+			worldSim.SetCompression(compression)
+			var data bytes.Buffer
+			err := worldSim.WriteRendered(&data, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readRendered(data.Bytes())).To(Equal(expected))
+
+			// and after converting to the default codec
+			var transcoded bytes.Buffer
+			var transcoder WorldSimulation
+			err = transcoder.ReadToWriter(bytes.NewReader(data.Bytes()), &transcoded, true, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readRendered(transcoded.Bytes())).To(Equal(expected))
+		})
+	}
+
+	It("should use registered codecs", func() {
+		var writers int
+		Expect(RegisterCompressionCodec(FirstUserCodec, countingCodec{&writers})).To(Succeed())
+
+		worldSim.SetCompression(Compression{Codec: FirstUserCodec})
+		var data bytes.Buffer
+		err := worldSim.WriteRendered(&data, true, ElevationFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(writers).To(Equal(3))
+		Expect(readRendered(data.Bytes())).To(Equal(expected))
+	})
+
+	It("should return an error for unknown codecs", func() {
+		worldSim.SetCompression(Compression{Codec: MaxCodec})
+		var data bytes.Buffer
+		err := worldSim.WriteRendered(&data, true, ElevationFrameFlag)
+		Expect(err).To(Equal(UnknownCodec))
+	})
+
+	It("should only register codecs in the user range", func() {
+		var writers int
+		Expect(RegisterCompressionCodec(GzipCodec, countingCodec{&writers})).To(Equal(InvalidOptions))
+		Expect(RegisterCompressionCodec(MaxCodec+1, countingCodec{&writers})).To(Equal(InvalidOptions))
+	})
+})
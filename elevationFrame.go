@@ -2,61 +2,177 @@ package worldDataFormat
 
 import (
 	"bytes"
-	"compress/gzip"
 	"encoding/binary"
 	"io" //"log"
-	"io/ioutil"
 	"math"
 )
 
+// bytes of DataSize, StorageFlags, HeaderLength, the quantization and sea level, from frame set version 2
+const elevationFrameHeaderLength = 64
+
+// longest header a reader accepts, leaving room for fields added after its version
+const maxElevationFrameHeaderLength = 4096
+
 type ElevationFrame struct {
 	sealevel           float64
-	elevations         []float64 // external getter and setter provided
-	renderedElevations []int16   // currently not externally accesible
+	elevations         []float64    // external getter and setter provided
+	renderedElevations []int32      // external getters provided
+	quantization       Quantization // of renderedElevations
 
 	data []byte // data stored here after read as we might not need to decompress it
 
+	// rendered data read from a frame set is stored as the difference from the previous frame
+	// or from the set's mean when average diffed
+	diffedFrom *ElevationFrame
+	// the mean of an average diffed set, stored ahead of its frames
+	isAverageBasis bool
+
 	// frame attributes used in header
-	dataReadSize     uint64
-	isFromCompressed bool
-	isFromRendered   bool
+	dataReadSize            uint64
+	isFromCompressed        bool
+	readCodec               uint64
+	isFromRendered          bool
+	isFromSelfDiffed        bool
+	isFromNeighborPredicted bool
+	isFromAverageDiffed     bool
+	isFromXorEncoded        bool
+	isKeyFrame              bool
+	hasChecksum             bool
 }
 
+// sea level the elevations are rendered relative to, stored with the frame
 func (frame *ElevationFrame) SetSealevel(value float64) {
 	frame.sealevel = value
+	// a rendering made from full elevations is relative to the old sea level
+	if !frame.isFromRendered {
+		frame.renderedElevations = nil
+	}
+}
+
+// sea level set before writing or read with the frame, 0 for frames written before it was stored
+// rendered values read from a file are relative to it
+func (frame *ElevationFrame) Sealevel() float64 {
+	return frame.sealevel
 }
 
 // need to update rendered, vs unrendered state when setting elevation values
 func (frame *ElevationFrame) SetElevations(values []float64) {
 	frame.elevations = values
 	frame.renderedElevations = nil
+	frame.quantization = Quantization{}
 	frame.isFromRendered = false
+	frame.isFromCompressed = false
+	frame.data = nil
+	frame.diffedFrom = nil
 }
 
+// full elevations, decoded from read data on first access
+// nil for rendered frames or if the read data could not be decoded, see Decode
 func (frame *ElevationFrame) Elevations() []float64 {
 	if frame.isFromRendered {
 		return nil
 	}
+	if frame.elevations == nil && frame.data != nil {
+		if frame.Decode() != nil {
+			return nil
+		}
+	}
 	return frame.elevations
 }
 
+// quantized elevations clamped to int16, whole meters from sea level with DefaultQuantization
+// see QuantizedElevations for values wider than 16 bits
+func (frame *ElevationFrame) RenderedElevations() []int16 {
+	quantized := frame.QuantizedElevations()
+	if quantized == nil {
+		return nil
+	}
+	var rendered = make([]int16, len(quantized))
+	for index, value := range quantized {
+		if value < math.MinInt16 {
+			rendered[index] = math.MinInt16
+		} else if value > math.MaxInt16 {
+			rendered[index] = math.MaxInt16
+		} else {
+			rendered[index] = int16(value)
+		}
+	}
+	return rendered
+}
+
+// elevations as written by WriteRendered, in steps of Quantization
+// decoded from read data on first access, or rendered from full elevations with DefaultQuantization
+func (frame *ElevationFrame) QuantizedElevations() []int32 {
+	if frame.renderedElevations == nil {
+		if frame.isFromRendered {
+			if frame.Decode() != nil {
+				return nil
+			}
+		} else if len(frame.Elevations()) != 0 {
+			frame.internalRenderElevations(DefaultQuantization)
+		}
+	}
+	return frame.renderedElevations
+}
+
+// how QuantizedElevations are stored, read with the frame or the one it was last rendered with
+func (frame *ElevationFrame) Quantization() Quantization {
+	if frame.renderedElevations == nil && !frame.isFromRendered {
+		return DefaultQuantization
+	}
+	return frame.quantization
+}
+
+// meters from sea level reconstructed from QuantizedElevations
+func (frame *ElevationFrame) ApproximateElevations() []float64 {
+	quantized := frame.QuantizedElevations()
+	if quantized == nil {
+		return nil
+	}
+	var approximate = make([]float64, len(quantized))
+	for index, value := range quantized {
+		approximate[index] = frame.quantization.meters(value)
+	}
+	return approximate
+}
+
+// decodes data read from a file, decompressing if needed
+// called on first access by the getters, exposed so read errors can be checked
+func (frame *ElevationFrame) Decode() error {
+	if frame.data == nil {
+		return nil
+	}
+	if frame.isFromRendered && frame.renderedElevations != nil {
+		return nil
+	} else if !frame.isFromRendered && frame.elevations != nil {
+		return nil
+	}
+	return frame.internalDecode()
+}
+
+// read frame was stored without the frame before it, so it decodes without its predecessors
+// the first frame of a set is always a key frame, whether or not it was written with a key frame interval
+func (frame *ElevationFrame) IsKeyFrame() bool {
+	return frame.data != nil && frame.diffedFrom == nil
+}
+
 // writes frame as loss-less float64s
 func (frame *ElevationFrame) WriteFull(target io.Writer, isCompressed bool) error {
-	return frame.internalWrite(target, isCompressed, false, nil)
+	return frame.internalWrite(target, frameEncoding{}.forWrite(isCompressed, false), nil)
 }
 
 // renders frame to a color scheme, information lost in data written
 func (frame *ElevationFrame) WriteRendered(target io.Writer, isCompressed bool) error {
-	return frame.internalWrite(target, isCompressed, true, nil)
+	return frame.internalWrite(target, frameEncoding{}.forWrite(isCompressed, true), nil)
 }
 
-// reads in frame header and data from source
+// reads in frame header and data from source, written by the current version
 func ReadElevationFrame(source io.Reader) (ElevationFrame, error) {
-	return internalReadElevationFrame(source)
+	return internalReadElevationFrame(source, FrameSetVersion)
 }
 
 // writes header values describing the frame data
-func (frame *ElevationFrame) writeHeader(target io.Writer, dataSize uint64, flags uint64) error {
+func (frame *ElevationFrame) writeHeader(target io.Writer, dataSize uint64, flags uint64, quantization Quantization) error {
 	//log.Printf("Writing size %d", dataSize)
 	err := binary.Write(target, binary.LittleEndian, dataSize)
 	if err != nil {
@@ -67,163 +183,442 @@ func (frame *ElevationFrame) writeHeader(target io.Writer, dataSize uint64, flag
 	if err != nil {
 		return err
 	}
+	var rounding uint64
+	if quantization.IsRounded {
+		rounding = 1
+	}
+	var extension = []interface{}{
+		uint64(elevationFrameHeaderLength),
+		quantization.Scale,
+		quantization.Offset,
+		uint64(quantization.Width),
+		rounding,
+		frame.sealevel,
+	}
+	for _, field := range extension {
+		err = binary.Write(target, binary.LittleEndian, field)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renders or decodes everything internalWrite will need from this frame and prevFrame
+// after this internalWrite only reads frame state, so frames of a set can be written concurrently
+func (frame *ElevationFrame) internalPrepareWrite(encoding frameEncoding, prevFrame *ElevationFrame) error {
+	if frame.canWriteStored(encoding, prevFrame) {
+		return nil
+	}
+	err := frame.Decode()
+	if err != nil {
+		return err
+	}
+	if encoding.isRendered {
+		frame.internalRenderFor(encoding.quantization)
+		if prevFrame != nil {
+			err = prevFrame.Decode()
+			if err != nil {
+				return err
+			}
+			prevFrame.internalRenderFor(encoding.quantization)
+		}
+	} else if prevFrame != nil {
+		return prevFrame.Decode()
+	}
 	return nil
 }
 
+// read data can be written as stored, apart from compression, if it was encoded the same way against the same frame
+func (frame *ElevationFrame) canWriteStored(encoding frameEncoding, prevFrame *ElevationFrame) bool {
+	return frame.isFromRendered && encoding.isRendered &&
+		frame.diffedFrom == prevFrame &&
+		frame.isFromSelfDiffed == encoding.isSelfDiffed &&
+		// frames off the icosphere grid are never predicted, those are written again to the same data
+		frame.isFromNeighborPredicted == (encoding.isSelfDiffed && encoding.isNeighborPredicted) &&
+		frame.isFromAverageDiffed == (encoding.isAverageDiffed && !frame.isAverageBasis)
+}
+
 // writes header followed by elevation frame data in the specified format (compressed or not, rendered or not)
 // prevFrame used for time series compression
-func (frame *ElevationFrame) internalWrite(target io.Writer, isCompressed, isRendered bool, prevFrame *ElevationFrame) error {
+func (frame *ElevationFrame) internalWrite(target io.Writer, encoding frameEncoding, prevFrame *ElevationFrame) error {
 	var err error
 	// must have data somewhere
 	if len(frame.elevations) == 0 && len(frame.renderedElevations) == 0 && frame.data == nil {
 		return NoData
 	}
 	var flags uint64
-	if isCompressed {
-		flags = flags | IsCompressedFlag
+	if encoding.isCompressed {
+		flags = flags | encoding.compression.storageFlags()
 	}
-	if isRendered {
+	if encoding.isRendered {
 		flags = flags | IsRenderedFlag
 	} else if frame.isFromRendered {
 		return InvalidData // can't unrender our data
 	}
+	// without a frame to XOR with, values are XORed with the one before them in the grid
+	var isXorEncoded = encoding.isXorEncoded && !encoding.isRendered
+	var isSelfDiffed = encoding.isSelfDiffed || (isXorEncoded && prevFrame == nil)
+	if isSelfDiffed {
+		flags = flags | IsSelfDiffedFlag
+	}
+	if isXorEncoded {
+		flags = flags | IsXorEncodedFlag
+	}
+	// frames that would otherwise be differenced against the one before them
+	if encoding.keyFrameInterval > 0 && prevFrame == nil && !frame.isAverageBasis && !encoding.isAverageDiffed &&
+		(encoding.isRendered || isXorEncoded) {
+		flags = flags | IsKeyFrameFlag
+	}
+	if frame.isAverageBasis {
+		flags = flags | IsAverageBasisFlag
+	} else if encoding.isAverageDiffed {
+		flags = flags | IsAverageDiffedFlag
+	}
+	if encoding.hasChecksum {
+		flags = flags | HasChecksumFlag
+	}
 
+	var dataToWrite []byte
 	// check if we have valid stored data
-	if frame.isFromRendered {
+	if frame.canWriteStored(encoding, prevFrame) {
 		//log.Print("writing from rendered")
-
 		// compress or decompress if needed
-		var dataToWrite []byte
-		if isCompressed && !frame.isFromCompressed {
-			//log.Print("rendered needs compression")
-			// compress it
-			var finalizedBuffer bytes.Buffer
-			zipWriter, err := gzip.NewWriterLevel(&finalizedBuffer, gzip.BestCompression)
-			if err != nil {
-				return err
-			}
-			_, err = zipWriter.Write(frame.data)
-			if err != nil {
-				return err
-			}
-			zipWriter.Close()
-			if err != nil {
-				return err
-			}
-			dataToWrite = finalizedBuffer.Bytes()
-		} else if !isCompressed && frame.isFromCompressed {
-			//log.Print("rendered needs decompression")
-			// decompress it
-			zipReader, err := gzip.NewReader(bytes.NewReader(frame.data))
-			if err != nil {
-				return err
-			}
-
-			dataToWrite, err = ioutil.ReadAll(zipReader)
-			if err != nil {
-				return err
-			}
-
-		} else {
-			//log.Print("writing rendered data directly")
-			// write the data read exactly as we got it
-			dataToWrite = frame.data
-		}
-
-		err = frame.writeHeader(target, uint64(len(dataToWrite)), flags)
+		dataToWrite, err = convertStoredData(frame.data, frame.isFromCompressed, frame.readCodec, encoding)
 		if err != nil {
 			return err
 		}
-
-		_, err = target.Write(dataToWrite)
+		if frame.isFromNeighborPredicted {
+			flags = flags | IsNeighborPredictedFlag
+		}
+	} else {
+		// we have full data currently, decoding it if it was read
+		err = frame.Decode()
 		if err != nil {
 			return err
 		}
-
-	} else {
-		// we have full data currently
 		// render if needed
-		if isRendered && frame.renderedElevations == nil {
-			// create our rendering
-			frame.internalRenderElevations() // default to relative for now
+		if encoding.isRendered {
+			frame.internalRenderFor(encoding.quantization)
 		}
 
 		var data bytes.Buffer
 
-		if isRendered {
-			// write values
+		if encoding.isRendered {
+			var prevRendered []int32
+			if prevFrame != nil {
+				err = prevFrame.Decode()
+				if err != nil {
+					return err
+				}
+				prevFrame.internalRenderFor(encoding.quantization)
+				prevRendered = prevFrame.renderedElevations
+				if len(prevRendered) != len(frame.renderedElevations) {
+					return InvalidData
+				}
+			}
+			var valuesToWrite = make([]int32, len(frame.renderedElevations))
 			for index, rendered := range frame.renderedElevations {
 				// if we have a previous frame, take difference for higher statistical redundancy before compression
-				var valueToWrite int16
 				if prevFrame != nil {
-					valueToWrite = rendered - prevFrame.renderedElevations[index]
+					valuesToWrite[index] = rendered - prevRendered[index]
 				} else {
-					valueToWrite = rendered
+					valuesToWrite[index] = rendered
 				}
-				err = binary.Write(&data, binary.LittleEndian, valueToWrite)
-				if err != nil {
-					return err
+			}
+			// then from a prediction, stored values wrap around on overflow so it can be undone exactly
+			// the value before, or on the icosphere grid the vertex's neighbours when asked for
+			if encoding.isSelfDiffed {
+				var topology *gridTopology
+				if encoding.isNeighborPredicted {
+					topology = icosphereTopology(len(valuesToWrite))
+				}
+				if topology != nil {
+					flags = flags | IsNeighborPredictedFlag
+					valuesToWrite = topology.encode(valuesToWrite, frame.quantization)
+				} else {
+					for index := len(valuesToWrite) - 1; index > 0; index-- {
+						valuesToWrite[index] -= valuesToWrite[index-1]
+					}
 				}
 			}
+			data.Write(frame.quantization.encodeValues(valuesToWrite))
 		} else {
-			for _, val := range frame.elevations {
-				err = binary.Write(&data, binary.LittleEndian, val)
+			var prevElevations []float64
+			if prevFrame != nil {
+				prevElevations = prevFrame.Elevations()
+				if len(prevElevations) != len(frame.elevations) {
+					return InvalidData
+				}
+			}
+			// differences of the bit patterns, float subtraction could not be undone exactly
+			var bitsToWrite = make([]uint64, len(frame.elevations))
+			for index, val := range frame.elevations {
+				bitsToWrite[index] = math.Float64bits(val)
+				if prevFrame != nil {
+					if isXorEncoded {
+						bitsToWrite[index] ^= math.Float64bits(prevElevations[index])
+					} else {
+						bitsToWrite[index] -= math.Float64bits(prevElevations[index])
+					}
+				}
+			}
+			if isSelfDiffed {
+				for index := len(bitsToWrite) - 1; index > 0; index-- {
+					if isXorEncoded {
+						bitsToWrite[index] ^= bitsToWrite[index-1]
+					} else {
+						bitsToWrite[index] -= bitsToWrite[index-1]
+					}
+				}
+			}
+			if isXorEncoded {
+				data.Write(xorPack(bitsToWrite))
+			} else {
+				err = binary.Write(&data, binary.LittleEndian, bitsToWrite)
 				if err != nil {
 					return err
 				}
 			}
 		}
 
-		var finalizedData bytes.Buffer
 		// compress if needed
-		if isCompressed {
-			zipWriter, err := gzip.NewWriterLevel(&finalizedData, gzip.BestCompression)
-			if err != nil {
-				return err
-			}
-			_, err = data.WriteTo(zipWriter)
-			if err != nil {
-				return err
-			}
-			zipWriter.Close()
+		if encoding.isCompressed {
+			dataToWrite, err = compressData(data.Bytes(), encoding.compression)
 			if err != nil {
 				return err
 			}
-
 		} else {
-			finalizedData = data
+			dataToWrite = data.Bytes()
 		}
+	}
+
+	// rendered frames keep the quantization they were rendered or read with
+	var quantization = encoding.quantization
+	if encoding.isRendered {
+		quantization = frame.quantization
+	}
+	var dataSize = uint64(len(dataToWrite))
+	if encoding.hasChecksum {
+		dataSize += checksumSize
+	}
+	err = frame.writeHeader(target, dataSize, flags, quantization)
+	if err != nil {
+		return err
+	}
 
-		err = frame.writeHeader(target, uint64(finalizedData.Len()), flags)
+	_, err = target.Write(dataToWrite)
+	if err != nil {
+		return err
+	}
+	if encoding.hasChecksum {
+		err = writeChecksum(target, dataToWrite)
 		if err != nil {
 			return err
 		}
+	}
 
-		_, err = finalizedData.WriteTo(target)
+	return nil
+}
+
+// the mean of every frame's elevations, rendered or full, which average diffed frames are stored relative to
+func internalAverageBasis(frames []Frame, encoding frameEncoding) (*ElevationFrame, error) {
+	var average = averageAccumulator{encoding: encoding}
+	for _, theFrame := range frames {
+		err := average.add(theFrame.Elevations)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
+	return average.basis(), nil
+}
+
+// running sums of the frames added so far, so the mean can follow a set as it grows
+type averageAccumulator struct {
+	encoding frameEncoding
+	width    int // wide enough for any frame's values
+	sums     []float64
+	count    int
+}
 
+func (average *averageAccumulator) add(frame *ElevationFrame) error {
+	err := frame.Decode()
+	if err != nil {
+		return err
+	}
+	if average.encoding.isRendered {
+		frame.internalRenderFor(average.encoding.quantization)
+		rendered := frame.renderedElevations
+		if frame.quantization.Width > average.width {
+			average.width = frame.quantization.Width
+		}
+		if average.sums == nil {
+			average.sums = make([]float64, len(rendered))
+		} else if len(rendered) != len(average.sums) {
+			return InvalidData
+		}
+		for index, value := range rendered {
+			average.sums[index] += float64(value)
+		}
+	} else {
+		elevations := frame.Elevations()
+		if average.sums == nil {
+			average.sums = make([]float64, len(elevations))
+		} else if len(elevations) != len(average.sums) {
+			return InvalidData
+		}
+		for index, value := range elevations {
+			average.sums[index] += value
+		}
+	}
+	average.count++
 	return nil
 }
 
-func (frame *ElevationFrame) internalRenderElevations() {
-	frame.renderedElevations = make([]int16, len(frame.elevations))
+// the mean of the frames added so far, rounded for rendered
+func (average *averageAccumulator) basis() *ElevationFrame {
+	var basis = ElevationFrame{isAverageBasis: true, quantization: average.encoding.quantization}
+	if average.encoding.isRendered {
+		if average.width > basis.quantization.Width {
+			basis.quantization.Width = average.width
+		}
+		basis.renderedElevations = make([]int32, len(average.sums))
+		for index, sum := range average.sums {
+			basis.renderedElevations[index] = int32(math.Round(sum / float64(average.count)))
+		}
+	} else {
+		basis.elevations = make([]float64, len(average.sums))
+		for index, sum := range average.sums {
+			basis.elevations[index] = sum / float64(average.count)
+		}
+	}
+	return &basis
+}
+
+// renders full elevations with quantization unless they already are, read rendered frames keep their own
+func (frame *ElevationFrame) internalRenderFor(quantization Quantization) {
+	if frame.isFromRendered || len(frame.elevations) == 0 {
+		return
+	}
+	if frame.renderedElevations == nil || frame.quantization != quantization {
+		frame.internalRenderElevations(quantization)
+	}
+}
+
+func (frame *ElevationFrame) internalRenderElevations(quantization Quantization) {
+	frame.quantization = quantization
+	frame.renderedElevations = make([]int32, len(frame.elevations))
 	for index, elevation := range frame.elevations {
-		var fromSeaLevel = elevation - frame.sealevel
-		if fromSeaLevel < float64(math.MinInt16) {
-			frame.renderedElevations[index] = math.MinInt16
-		} else if fromSeaLevel > float64(math.MaxInt16) {
-			frame.renderedElevations[index] = math.MaxInt16
-		} else {
-			frame.renderedElevations[index] = int16(fromSeaLevel)
+		frame.renderedElevations[index] = quantization.quantize(elevation - frame.sealevel)
+	}
+}
+
+// turns frame.data into elevations or rendered elevations
+func (frame *ElevationFrame) internalDecode() error {
+	var err error
+	var raw []byte
+	if frame.isFromCompressed {
+		raw, err = decompressData(frame.data, frame.readCodec)
+		if err != nil {
+			return err
 		}
+	} else {
+		raw = frame.data
 	}
+
+	if frame.isFromRendered {
+		rendered, err := frame.quantization.decodeValues(raw)
+		if err != nil {
+			return err
+		}
+		if frame.isFromSelfDiffed && frame.isFromNeighborPredicted {
+			topology := icosphereTopology(len(rendered))
+			if topology == nil {
+				return InvalidData
+			}
+			topology.decode(rendered, frame.quantization)
+		} else if frame.isFromSelfDiffed {
+			for index := 1; index < len(rendered); index++ {
+				rendered[index] = frame.quantization.wrap(rendered[index] + rendered[index-1])
+			}
+		}
+		// undo temporal differencing, the frame we were differenced from decodes its own chain first
+		if frame.diffedFrom != nil {
+			err = frame.diffedFrom.Decode()
+			if err != nil {
+				return err
+			}
+			if len(frame.diffedFrom.renderedElevations) != len(rendered) {
+				return InvalidData
+			}
+			for index, prev := range frame.diffedFrom.renderedElevations {
+				rendered[index] = frame.quantization.wrap(rendered[index] + prev)
+			}
+		}
+		frame.renderedElevations = rendered
+	} else if frame.isFromXorEncoded {
+		values, err := xorUnpack(raw)
+		if err != nil {
+			return err
+		}
+		if frame.isFromSelfDiffed {
+			for index := 1; index < len(values); index++ {
+				values[index] ^= values[index-1]
+			}
+		}
+		// undo XOR with the previous frame or the set's mean
+		if frame.diffedFrom != nil {
+			err = frame.diffedFrom.Decode()
+			if err != nil {
+				return err
+			}
+			if len(frame.diffedFrom.elevations) != len(values) {
+				return InvalidData
+			}
+			for index, base := range frame.diffedFrom.elevations {
+				values[index] ^= math.Float64bits(base)
+			}
+		}
+		elevations := make([]float64, len(values))
+		for index, value := range values {
+			elevations[index] = math.Float64frombits(value)
+		}
+		frame.elevations = elevations
+	} else {
+		if len(raw)%8 != 0 {
+			return InvalidData
+		}
+		elevations := make([]float64, len(raw)/8)
+		var bits uint64
+		for index := range elevations {
+			if frame.isFromSelfDiffed {
+				bits += binary.LittleEndian.Uint64(raw[index*8:])
+			} else {
+				bits = binary.LittleEndian.Uint64(raw[index*8:])
+			}
+			elevations[index] = math.Float64frombits(bits)
+		}
+		// undo differencing from the set's mean
+		if frame.diffedFrom != nil {
+			err = frame.diffedFrom.Decode()
+			if err != nil {
+				return err
+			}
+			if len(frame.diffedFrom.elevations) != len(elevations) {
+				return InvalidData
+			}
+			for index, base := range frame.diffedFrom.elevations {
+				elevations[index] = math.Float64frombits(math.Float64bits(elevations[index]) + math.Float64bits(base))
+			}
+		}
+		frame.elevations = elevations
+	}
+	return nil
 }
 
 // reads frame header, must be called before we can read the elevation or rendered elevation data
-func (frame *ElevationFrame) internalReadHeader(source io.Reader) error {
+// the layout depends on the version of the frame set it was written in
+func (frame *ElevationFrame) internalReadHeader(source io.Reader, version uint64) error {
 	err := binary.Read(source, binary.LittleEndian, &frame.dataReadSize)
 	if err != nil {
 		return err
@@ -238,29 +633,84 @@ func (frame *ElevationFrame) internalReadHeader(source io.Reader) error {
 	//log.Printf("Read flags as: %d", flags)
 	if flags&IsCompressedFlag > 0 {
 		frame.isFromCompressed = true
+		frame.readCodec = codecFromFlags(flags)
 	}
 	if flags&IsRenderedFlag > 0 {
 		frame.isFromRendered = true
 	}
+	if flags&IsSelfDiffedFlag > 0 {
+		frame.isFromSelfDiffed = true
+	}
+	if flags&IsNeighborPredictedFlag > 0 {
+		frame.isFromNeighborPredicted = true
+	}
+	if flags&IsAverageDiffedFlag > 0 {
+		frame.isFromAverageDiffed = true
+	}
+	if flags&IsAverageBasisFlag > 0 {
+		frame.isAverageBasis = true
+	}
+	if flags&IsXorEncodedFlag > 0 {
+		frame.isFromXorEncoded = true
+	}
+	if flags&IsKeyFrameFlag > 0 {
+		frame.isKeyFrame = true
+	}
+	if flags&HasChecksumFlag > 0 {
+		frame.hasChecksum = true
+	}
+
+	// version 1 rendered every frame with the default
+	frame.quantization = DefaultQuantization
+	if version < 2 {
+		return nil
+	}
+	var headerLength uint64
+	err = binary.Read(source, binary.LittleEndian, &headerLength)
+	if err != nil {
+		return err
+	}
+	if headerLength < 24 || headerLength > maxElevationFrameHeaderLength {
+		return InvalidData
+	}
+	// fields this version does not know are skipped, missing ones keep their defaults
+	var extension = make([]byte, headerLength-24)
+	_, err = io.ReadFull(source, extension)
+	if err != nil {
+		return err
+	}
+	if len(extension) >= 32 {
+		frame.quantization.Scale = math.Float64frombits(binary.LittleEndian.Uint64(extension[0:]))
+		frame.quantization.Offset = math.Float64frombits(binary.LittleEndian.Uint64(extension[8:]))
+		frame.quantization.Width = int(binary.LittleEndian.Uint64(extension[16:]))
+		frame.quantization.IsRounded = binary.LittleEndian.Uint64(extension[24:])&1 > 0
+	}
+	if len(extension) >= 40 {
+		frame.sealevel = math.Float64frombits(binary.LittleEndian.Uint64(extension[32:]))
+	}
 	return nil
 }
 
 // reads header, and stores data unmodified in frame.data
-func internalReadElevationFrame(source io.Reader) (ElevationFrame, error) {
+func internalReadElevationFrame(source io.Reader, version uint64) (ElevationFrame, error) {
 	var frame ElevationFrame
 
-	err := frame.internalReadHeader(source)
+	err := frame.internalReadHeader(source, version)
 	if err != nil {
 		return frame, err
 	}
 
-	frame.data = make([]byte, frame.dataReadSize)
-
-	_, err = io.ReadFull(source, frame.data)
+	frame.data, err = readBounded(source, frame.dataReadSize)
 	if err != nil {
 		//log.Print("Error reading elevation frame")
 		return frame, err
 	}
+	if frame.hasChecksum {
+		frame.data, err = verifyChecksum(frame.data, ElevationFrameFlag)
+		if err != nil {
+			return frame, err
+		}
+	}
 
 	return frame, nil
 }
@@ -166,4 +166,93 @@ var _ = Describe("ElevationFrame", func() {
 		})
 	})
 
+	Context("after a read", func() {
+		var fullFrame ElevationFrame
+		var testElev []float64 = []float64{-3900.5, -300, 0, 1234.25, 4586, 12300.75, 40000}
+
+		BeforeEach(func() {
+			fullFrame = ElevationFrame{}
+			fullFrame.SetElevations(testElev)
+		})
+
+		for _, isCompressed := range []bool{false, true} {
+			isCompressed := isCompressed
+
+			It(fmt.Sprintf("should decode full elevations, compressed: %t", isCompressed), func() {
+				var buf bytes.Buffer
+				err := fullFrame.WriteFull(&buf, isCompressed)
+				Expect(err).ToNot(HaveOccurred())
+
+				frame, err := ReadElevationFrame(&buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.Decode()).To(Succeed())
+				Expect(frame.Elevations()).To(Equal(testElev))
+			})
+
+			It(fmt.Sprintf("should decode rendered elevations, compressed: %t", isCompressed), func() {
+				var buf bytes.Buffer
+				err := fullFrame.WriteRendered(&buf, isCompressed)
+				Expect(err).ToNot(HaveOccurred())
+
+				frame, err := ReadElevationFrame(&buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.Elevations()).To(BeNil())
+				Expect(frame.RenderedElevations()).To(Equal([]int16{-3900, -300, 0, 1234, 4586, 12300, 32767}))
+			})
+		}
+
+		It("should keep the sea level", func() {
+			fullFrame.SetSealevel(-120.5)
+			for _, isRendered := range []bool{false, true} {
+				var buf bytes.Buffer
+				if isRendered {
+					Expect(fullFrame.WriteRendered(&buf, true)).To(Succeed())
+				} else {
+					Expect(fullFrame.WriteFull(&buf, true)).To(Succeed())
+				}
+
+				frame, err := ReadElevationFrame(&buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.Sealevel()).To(BeNumerically("==", -120.5))
+			}
+		})
+
+		It("should read headers shorter or longer than it knows", func() {
+			rendered := []int16{-3, 0, 12}
+			for _, headerLength := range []uint64{56, 72} {
+				var buf bytes.Buffer
+				fields := []interface{}{uint64(2 * len(rendered)), uint64(IsRenderedFlag), headerLength,
+					float64(1), float64(0), uint64(2), uint64(0)}
+				for _, field := range fields {
+					Expect(binary.Write(&buf, binary.LittleEndian, field)).To(Succeed())
+				}
+				// a sea level and a field from a later version
+				if headerLength > 56 {
+					Expect(binary.Write(&buf, binary.LittleEndian, []float64{25, 99})).To(Succeed())
+				}
+				Expect(binary.Write(&buf, binary.LittleEndian, rendered)).To(Succeed())
+
+				frame, err := ReadElevationFrame(&buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.RenderedElevations()).To(Equal(rendered))
+				if headerLength > 56 {
+					Expect(frame.Sealevel()).To(BeNumerically("==", 25))
+				} else {
+					Expect(frame.Sealevel()).To(BeNumerically("==", 0))
+				}
+			}
+		})
+
+		It("should report corrupt data from Decode", func() {
+			var buf bytes.Buffer
+			err := fullFrame.WriteFull(&buf, true)
+			Expect(err).ToNot(HaveOccurred())
+			buf.Bytes()[64] ^= 0xff // break the gzip header after the frame header
+
+			frame, err := ReadElevationFrame(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.Decode()).ToNot(Succeed())
+			Expect(frame.Elevations()).To(BeNil())
+		})
+	})
 })
@@ -2,6 +2,7 @@ package worldDataFormat
 
 import (
 	"errors"
+	"fmt"
 )
 
 var NoData = errors.New("No Data")
@@ -11,4 +12,28 @@ var MissingGridDefinition = errors.New("Grid Definition was not set")
 
 var RenderedOnlyFrame = errors.New("Frame type must be rendered.")
 
-var IncompatibleVersion = errors.New("Incompatible Version")
\ No newline at end of file
+var IncompatibleVersion = errors.New("Incompatible Version")
+
+var FrameSetOutOfRange = errors.New("Frame set index out of range")
+
+var ReaderClosed = errors.New("Reader closed")
+
+var NoSource = errors.New("No source opened")
+
+var InvalidOptions = errors.New("Invalid Options")
+
+var UnknownCodec = errors.New("Unknown compression codec")
+
+// returned when writing a frame type without a registered FrameCodec
+var UnknownFrameType = errors.New("Unknown frame type")
+
+// returned when a frame's data or a type block does not match the checksum stored with it, see HasChecksumFlag and HasBlockChecksumsFlag
+type ChecksumError struct {
+	FrameSet  int    // index of the set in the file, -1 when read outside a file
+	Frame     int    // index of the frame in the set, -1 for the mean of an average diffed set, a whole type block or outside a set
+	FrameType uint64 // flag of the frame's type
+}
+
+func (err *ChecksumError) Error() string {
+	return fmt.Sprintf("Checksum mismatch in frame set %d, frame %d, type %d", err.FrameSet, err.Frame, err.FrameType)
+}
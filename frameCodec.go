@@ -0,0 +1,378 @@
+package worldDataFormat
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+	"sync"
+)
+
+// TypesBitField bits from here up are free for RegisterFrameCodec, the bits below are the built in types
+const FirstUserFrameFlag = 1 << 3
+
+// how the set being written is stored, for user codecs to follow where it makes sense
+type FrameCodecOptions struct {
+	IsCompressed bool
+	IsRendered   bool
+	Compression  Compression // codec and level to compress with when IsCompressed
+}
+
+// encodes a user defined per vertex layer, kept in Frame.Layers under the flag it is registered with
+// each set stores the layers of all its frames as one block of its own, so codecs may difference or compress across frames
+// with SetChecksummed blocks are checked against a checksum in the set header before ReadFrames sees them
+type FrameCodec interface {
+	// writes the layer of every frame of a set in frame order, no layer is nil
+	// at least a byte for each frame, so readers can tell a corrupted frame count from a real one
+	// may run alongside the encoding of other types and other sets' layers, so must not share unguarded state
+	WriteFrames(target io.Writer, layers []interface{}, options FrameCodecOptions) error
+	// reads back the layers of frameCount frames from a block holding exactly the bytes WriteFrames wrote
+	ReadFrames(block []byte, frameCount int) ([]interface{}, error)
+}
+
+// writes and reads the block of one frame type in a set, built in types and user codecs alike
+type frameTypeCodec interface {
+	hasFrame(frame *Frame) bool
+	// readies the set's frames in frame order, anything that changes frame state happens here
+	// the jobs returned then encode the block, run alongside those of every other type
+	prepareBlock(set *FrameSet, encoding frameEncoding) (blockWrite, error)
+	// reads blockSize bytes of frames into the set's frames
+	readBlock(source io.Reader, set *FrameSet, blockSize uint64) error
+	// the bytes the frame at index adds to the set's block when written after the frames before it
+	encodeFrame(sized *sizedFrameSet, index int) ([]byte, error)
+	// whether the frames from encodeFrame, in order, are the block prepareBlock would write, so they can be written as is
+	isBlockOfFrames(encoding frameEncoding) bool
+}
+
+// the encoding of one type's block in a set, each job writes only to its own part
+// and the parts, in order, are the block
+type blockWrite struct {
+	jobs  []func() error
+	parts []bytes.Buffer
+}
+
+func (block *blockWrite) size() uint64 {
+	var size uint64
+	for index := range block.parts {
+		size += uint64(block.parts[index].Len())
+	}
+	return size
+}
+
+type registeredFrameType struct {
+	flag  uint64
+	codec frameTypeCodec
+}
+
+var frameCodecLock sync.RWMutex
+var frameCodecs = map[uint64]frameTypeCodec{
+	AgeFrameFlag:       ageCodec{},
+	ElevationFrameFlag: elevationCodec{},
+	SatalliteFrameFlag: satalliteCodec{},
+}
+
+// makes codec available for reading and writing frames of the type flag, a single bit from FirstUserFrameFlag up
+func RegisterFrameCodec(flag uint64, codec FrameCodec) error {
+	if flag < FirstUserFrameFlag || bits.OnesCount64(flag) != 1 || codec == nil {
+		return InvalidOptions
+	}
+	frameCodecLock.Lock()
+	defer frameCodecLock.Unlock()
+	frameCodecs[flag] = userFrameCodec{flag: flag, codec: codec}
+	return nil
+}
+
+func lookupFrameType(flag uint64) (frameTypeCodec, bool) {
+	frameCodecLock.RLock()
+	defer frameCodecLock.RUnlock()
+	codec, ok := frameCodecs[flag]
+	return codec, ok
+}
+
+// codecs of every type in types in bit order, the order their blocks are stored in, UnknownFrameType if any is not registered
+func lookupFrameTypes(types uint64) ([]registeredFrameType, error) {
+	var frameTypes []registeredFrameType
+	for bit := 0; bit < 64; bit++ {
+		var flag = uint64(1) << uint(bit)
+		if types&flag == 0 {
+			continue
+		}
+		codec, ok := lookupFrameType(flag)
+		if !ok {
+			return nil, UnknownFrameType
+		}
+		frameTypes = append(frameTypes, registeredFrameType{flag: flag, codec: codec})
+	}
+	return frameTypes, nil
+}
+
+// what the frame's codec writes
+func encodedFrame(write func(target io.Writer) error) ([]byte, error) {
+	var data bytes.Buffer
+	err := write(&data)
+	return data.Bytes(), err
+}
+
+type ageCodec struct{}
+
+func (ageCodec) hasFrame(frame *Frame) bool {
+	return frame.Age != nil
+}
+
+func (ageCodec) prepareBlock(set *FrameSet, encoding frameEncoding) (blockWrite, error) {
+	var block = blockWrite{parts: make([]bytes.Buffer, 1)}
+	block.jobs = append(block.jobs, func() error {
+		for _, theFrame := range set.frames {
+			err := theFrame.Age.internalWrite(&block.parts[0])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return block, nil
+}
+
+func (ageCodec) readBlock(source io.Reader, set *FrameSet, blockSize uint64) error {
+	for index := range set.frames {
+		ageFrame, err := internalReadAgeFrame(source)
+		if err != nil {
+			return err
+		}
+		set.frames[index].Age = &ageFrame
+	}
+	return nil
+}
+
+func (ageCodec) encodeFrame(sized *sizedFrameSet, index int) ([]byte, error) {
+	return encodedFrame(sized.set.frames[index].Age.internalWrite)
+}
+
+func (ageCodec) isBlockOfFrames(encoding frameEncoding) bool {
+	return true
+}
+
+type elevationCodec struct{}
+
+func (elevationCodec) hasFrame(frame *Frame) bool {
+	return frame.Elevations != nil
+}
+
+func (elevationCodec) prepareBlock(set *FrameSet, encoding frameEncoding) (blockWrite, error) {
+	var err error
+	var block blockWrite
+	// the mean of an average diffed set is stored ahead of the frames that are differenced against it
+	var firstFramePart int
+	if encoding.isAverageDiffed {
+		firstFramePart = 1
+	}
+	block.parts = make([]bytes.Buffer, firstFramePart+len(set.frames))
+
+	// rendered elevations build on the frame before them, which must be ready by now
+	var averageBasis *ElevationFrame
+	if encoding.isAverageDiffed {
+		averageBasis, err = internalAverageBasis(set.frames, encoding)
+		if err != nil {
+			return block, err
+		}
+		err = averageBasis.internalWrite(&block.parts[0], encoding, nil)
+		if err != nil {
+			return block, err
+		}
+	}
+	for index, theFrame := range set.frames {
+		err = theFrame.Elevations.internalPrepareWrite(encoding, set.elevationDiffBase(index, encoding, averageBasis))
+		if err != nil {
+			return block, err
+		}
+	}
+
+	// each frame is then encoded and compressed to its own part
+	for index, theFrame := range set.frames {
+		index, theFrame := index, theFrame
+		block.jobs = append(block.jobs, func() error {
+			return theFrame.Elevations.internalWrite(&block.parts[firstFramePart+index], encoding, set.elevationDiffBase(index, encoding, averageBasis))
+		})
+	}
+	return block, nil
+}
+
+func (elevationCodec) readBlock(source io.Reader, set *FrameSet, blockSize uint64) error {
+	var averageBasis *ElevationFrame
+	for index := 0; index < len(set.frames); {
+		elevationFrame, err := internalReadElevationFrame(source, set.version)
+		if checksumErr, ok := err.(*ChecksumError); ok {
+			checksumErr.Frame = index
+			if elevationFrame.isAverageBasis {
+				checksumErr.Frame = -1
+			}
+		}
+		if err != nil {
+			return err
+		}
+		// the mean of an average diffed set comes before its frames
+		if elevationFrame.isAverageBasis {
+			averageBasis = &elevationFrame
+			continue
+		}
+		set.frames[index].Elevations = &elevationFrame
+		index++
+	}
+	for index := 0; index < len(set.frames); index++ {
+		elevationFrame := set.frames[index].Elevations
+		if elevationFrame.isFromAverageDiffed {
+			if averageBasis == nil {
+				return InvalidData
+			}
+			elevationFrame.diffedFrom = averageBasis
+		} else if (elevationFrame.isFromRendered || elevationFrame.isFromXorEncoded) && index > 0 && !elevationFrame.isKeyFrame {
+			// rendered and XOR encoded frames after the first are stored as differences from the frame before them
+			elevationFrame.diffedFrom = set.frames[index-1].Elevations
+		}
+	}
+	return nil
+}
+
+// differenced against the same frame as when the set is written, for average diffed sets the mean of the frames up to index
+// as the mean of the whole set is not known yet, with the first frame also counting the mean stored ahead of it
+func (elevationCodec) encodeFrame(sized *sizedFrameSet, index int) ([]byte, error) {
+	var set, encoding = &sized.set, sized.encoding
+	var data bytes.Buffer
+	var averageBasis *ElevationFrame
+	if encoding.isAverageDiffed {
+		sized.average.encoding = encoding
+		err := sized.average.add(set.frames[index].Elevations)
+		if err != nil {
+			return nil, err
+		}
+		averageBasis = sized.average.basis()
+		if index == 0 {
+			err = averageBasis.internalWrite(&data, encoding, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err := set.frames[index].Elevations.internalWrite(&data, encoding, set.elevationDiffBase(index, encoding, averageBasis))
+	return data.Bytes(), err
+}
+
+// the mean of average diffed sets changes with every frame, so their frames are encoded again
+func (elevationCodec) isBlockOfFrames(encoding frameEncoding) bool {
+	return !encoding.isAverageDiffed
+}
+
+type satalliteCodec struct{}
+
+func (satalliteCodec) hasFrame(frame *Frame) bool {
+	return frame.Satallite != nil
+}
+
+func (satalliteCodec) prepareBlock(set *FrameSet, encoding frameEncoding) (blockWrite, error) {
+	var block = blockWrite{parts: make([]bytes.Buffer, len(set.frames))}
+	// diffed colors build on the frame before them, which must be ready by now
+	for index, theFrame := range set.frames {
+		err := theFrame.Satallite.internalPrepareWrite(set.satalliteDiffBase(index, encoding))
+		if err != nil {
+			return block, err
+		}
+	}
+
+	for index, theFrame := range set.frames {
+		index, theFrame := index, theFrame
+		block.jobs = append(block.jobs, func() error {
+			return theFrame.Satallite.internalWrite(&block.parts[index], encoding, set.satalliteDiffBase(index, encoding))
+		})
+	}
+	return block, nil
+}
+
+func (satalliteCodec) readBlock(source io.Reader, set *FrameSet, blockSize uint64) error {
+	for index := range set.frames {
+		satalliteFrame, err := internalReadSatalliteFrame(source)
+		if checksumErr, ok := err.(*ChecksumError); ok {
+			checksumErr.Frame = index
+		}
+		if err != nil {
+			return err
+		}
+		set.frames[index].Satallite = &satalliteFrame
+		if satalliteFrame.isFromTemporalDiffed {
+			if index == 0 {
+				return InvalidData
+			}
+			satalliteFrame.diffedFrom = set.frames[index-1].Satallite
+		}
+	}
+	return nil
+}
+
+func (satalliteCodec) encodeFrame(sized *sizedFrameSet, index int) ([]byte, error) {
+	return encodedFrame(func(target io.Writer) error {
+		return sized.set.frames[index].Satallite.internalWrite(target, sized.encoding, sized.set.satalliteDiffBase(index, sized.encoding))
+	})
+}
+
+func (satalliteCodec) isBlockOfFrames(encoding frameEncoding) bool {
+	return true
+}
+
+// a registered FrameCodec, reading and writing the layers kept under its flag
+type userFrameCodec struct {
+	flag  uint64
+	codec FrameCodec
+}
+
+func (userCodec userFrameCodec) hasFrame(frame *Frame) bool {
+	return frame.Layers[userCodec.flag] != nil
+}
+
+func (userCodec userFrameCodec) prepareBlock(set *FrameSet, encoding frameEncoding) (blockWrite, error) {
+	var layers = make([]interface{}, len(set.frames))
+	for index, theFrame := range set.frames {
+		layers[index] = theFrame.Layers[userCodec.flag]
+	}
+	var block = blockWrite{parts: make([]bytes.Buffer, 1)}
+	block.jobs = append(block.jobs, func() error {
+		err := userCodec.codec.WriteFrames(&block.parts[0], layers, encoding.codecOptions())
+		if err == nil && block.parts[0].Len() < len(layers) {
+			return InvalidData
+		}
+		return err
+	})
+	return block, nil
+}
+
+func (userCodec userFrameCodec) readBlock(source io.Reader, set *FrameSet, blockSize uint64) error {
+	var block bytes.Buffer
+	_, err := io.CopyN(&block, source, int64(blockSize))
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	layers, err := userCodec.codec.ReadFrames(block.Bytes(), len(set.frames))
+	if err != nil {
+		return err
+	} else if len(layers) != len(set.frames) {
+		return InvalidData
+	}
+	for index, layer := range layers {
+		if set.frames[index].Layers == nil {
+			set.frames[index].Layers = make(map[uint64]interface{})
+		}
+		set.frames[index].Layers[userCodec.flag] = layer
+	}
+	return nil
+}
+
+// as the block of a set holding only the frame
+func (userCodec userFrameCodec) encodeFrame(sized *sizedFrameSet, index int) ([]byte, error) {
+	return encodedFrame(func(target io.Writer) error {
+		return userCodec.codec.WriteFrames(target, []interface{}{sized.set.frames[index].Layers[userCodec.flag]}, sized.encoding.codecOptions())
+	})
+}
+
+// codecs encode a set's layers together, so the block is written from all of them
+func (userCodec userFrameCodec) isBlockOfFrames(encoding frameEncoding) bool {
+	return false
+}
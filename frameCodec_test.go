@@ -0,0 +1,254 @@
+package worldDataFormat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"runtime"
+	"time"
+
+	. "github.com/Smerom/WorldDataFormat"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// temperatures as float32, each frame stored as the difference from the one before it
+type temperatureCodec struct{}
+
+func (temperatureCodec) WriteFrames(target io.Writer, layers []interface{}, options FrameCodecOptions) error {
+	var previous []float32
+	for _, layer := range layers {
+		values := layer.([]float32)
+		err := binary.Write(target, binary.LittleEndian, uint64(len(values)))
+		if err != nil {
+			return err
+		}
+		for index, value := range values {
+			if previous != nil {
+				value -= previous[index]
+			}
+			err = binary.Write(target, binary.LittleEndian, value)
+			if err != nil {
+				return err
+			}
+		}
+		previous = values
+	}
+	return nil
+}
+
+func (temperatureCodec) ReadFrames(block []byte, frameCount int) ([]interface{}, error) {
+	var layers []interface{}
+	var previous []float32
+	for f := 0; f < frameCount; f++ {
+		if len(block) < 8 {
+			return nil, InvalidData
+		}
+		count := int(binary.LittleEndian.Uint64(block))
+		block = block[8:]
+		if len(block) < 4*count {
+			return nil, InvalidData
+		}
+		values := make([]float32, count)
+		for index := range values {
+			values[index] = math.Float32frombits(binary.LittleEndian.Uint32(block[4*index:]))
+			if previous != nil {
+				values[index] += previous[index]
+			}
+		}
+		block = block[4*count:]
+		layers = append(layers, values)
+		previous = values
+	}
+	return layers, nil
+}
+
+const temperatureFlag = 1 << 5
+
+// stores nothing, which readers could not tell from a corrupted frame count
+type emptyCodec struct{}
+
+func (emptyCodec) WriteFrames(target io.Writer, layers []interface{}, options FrameCodecOptions) error {
+	return nil
+}
+
+func (emptyCodec) ReadFrames(block []byte, frameCount int) ([]interface{}, error) {
+	return make([]interface{}, frameCount), nil
+}
+
+// writes a byte per frame once its partner has started writing, to show codecs of different types run together
+type rendezvousCodec struct {
+	started chan struct{}
+	partner chan struct{}
+}
+
+func (codec rendezvousCodec) WriteFrames(target io.Writer, layers []interface{}, options FrameCodecOptions) error {
+	close(codec.started)
+	select {
+	case <-codec.partner:
+	case <-time.After(5 * time.Second):
+		return errors.New("partner codec never started")
+	}
+	_, err := target.Write(make([]byte, len(layers)))
+	return err
+}
+
+func (codec rendezvousCodec) ReadFrames(block []byte, frameCount int) ([]interface{}, error) {
+	var layers []interface{}
+	for f := 0; f < frameCount; f++ {
+		layers = append(layers, block[f])
+	}
+	return layers, nil
+}
+
+var _ = Describe("FrameCodec", func() {
+	var temperatures = [][]float32{{12.5, -3, 40}, {13, -2.5, 39.5}, {14.25, -2, 38}}
+
+	BeforeEach(func() {
+		Expect(RegisterFrameCodec(temperatureFlag, temperatureCodec{})).To(Succeed())
+	})
+
+	newSim := func(withLayers bool) WorldSimulation {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		var set FrameSet
+		for f, values := range temperatures {
+			var elevations ElevationFrame
+			elevations.SetElevations([]float64{float64(f), 1, 2})
+			frame := Frame{Age: &AgeFrame{Age: float64(f)}, Elevations: &elevations}
+			if withLayers {
+				frame.Layers = map[uint64]interface{}{temperatureFlag: values}
+			}
+			set.AddFrame(frame)
+		}
+		sim.AddFrameSet(set)
+		return sim
+	}
+
+	write := func(sim WorldSimulation, typesToWrite uint64) []byte {
+		var data bytes.Buffer
+		Expect(sim.WriteRendered(&data, true, typesToWrite)).To(Succeed())
+		return data.Bytes()
+	}
+
+	expectTemperatures := func(frames []Frame) {
+		Expect(len(frames)).To(Equal(len(temperatures)))
+		for f, frame := range frames {
+			Expect(frame.Layers[temperatureFlag]).To(Equal(temperatures[f]))
+			Expect(frame.Age.Age).To(BeNumerically("==", f))
+		}
+	}
+
+	It("should round trip user frame types alongside the built in ones", func() {
+		data := write(newSim(true), AgeFrameFlag|ElevationFrameFlag|temperatureFlag)
+		readSim, err := ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		expectTemperatures(readSim.FrameSets()[0].Frames())
+		Expect(readSim.FrameSets()[0].Frames()[2].Elevations.RenderedElevations()).To(Equal([]int16{2, 1, 2}))
+	})
+
+	It("should skip user frame types not asked for", func() {
+		data := write(newSim(true), AgeFrameFlag|temperatureFlag)
+		readSim, err := ReadWorldSimulationTypes(bytes.NewReader(data), AgeFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		for _, frame := range readSim.FrameSets()[0].Frames() {
+			Expect(frame.Layers).To(BeNil())
+		}
+
+		index, err := BuildSimulationIndex(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		set, err := index.ReadFrameSetTypes(0, temperatureFlag)
+		Expect(err).ToNot(HaveOccurred())
+		for f, frame := range set.Frames() {
+			Expect(frame.Age).To(BeNil())
+			Expect(frame.Layers[temperatureFlag]).To(Equal(temperatures[f]))
+		}
+	})
+
+	It("should carry user frame types through a transcode", func() {
+		data := write(newSim(true), ElevationFrameFlag|temperatureFlag|AgeFrameFlag)
+		var transcoded bytes.Buffer
+		var transcoder WorldSimulation
+		err := transcoder.ReadToWriter(bytes.NewReader(data), &transcoded, false, true, AgeFrameFlag|temperatureFlag)
+		Expect(err).ToNot(HaveOccurred())
+
+		readSim, err := ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		expectTemperatures(readSim.FrameSets()[0].Frames())
+	})
+
+	It("should check blocks with the set when checksummed", func() {
+		sim := newSim(true)
+		sim.SetChecksummed(true)
+		data := write(sim, AgeFrameFlag|temperatureFlag)
+		readSim, err := ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		expectTemperatures(readSim.FrameSets()[0].Frames())
+
+		// the last temperature of the last frame
+		data[len(data)-1] ^= 0x10
+		_, err = ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).To(Equal(&ChecksumError{FrameSet: 0, Frame: -1, FrameType: temperatureFlag}))
+	})
+
+	It("should need a layer for every frame", func() {
+		var data bytes.Buffer
+		sim := newSim(false)
+		Expect(sim.WriteRendered(&data, false, AgeFrameFlag|temperatureFlag)).To(Equal(MissingData))
+	})
+
+	It("should refuse blocks without a byte for each frame", func() {
+		Expect(RegisterFrameCodec(1<<8, emptyCodec{})).To(Succeed())
+		var data bytes.Buffer
+		sim := newSim(true)
+		for _, frame := range sim.FrameSets()[0].Frames() {
+			frame.Layers[1<<8] = true
+		}
+		Expect(sim.WriteRendered(&data, false, 1<<8)).To(Equal(InvalidData))
+	})
+
+	It("should refuse to write types without a codec", func() {
+		var data bytes.Buffer
+		sim := newSim(true)
+		Expect(sim.WriteRendered(&data, false, AgeFrameFlag|1<<40)).To(Equal(UnknownFrameType))
+	})
+
+	It("should only register single user bits", func() {
+		Expect(RegisterFrameCodec(ElevationFrameFlag, temperatureCodec{})).To(Equal(InvalidOptions))
+		Expect(RegisterFrameCodec(1<<6|1<<7, temperatureCodec{})).To(Equal(InvalidOptions))
+		Expect(RegisterFrameCodec(1<<6, nil)).To(Equal(InvalidOptions))
+	})
+
+	It("should encode the blocks of different types concurrently", func() {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+		first, second := make(chan struct{}), make(chan struct{})
+		Expect(RegisterFrameCodec(1<<6, rendezvousCodec{started: first, partner: second})).To(Succeed())
+		Expect(RegisterFrameCodec(1<<7, rendezvousCodec{started: second, partner: first})).To(Succeed())
+
+		sim := newSim(true)
+		for _, frame := range sim.FrameSets()[0].Frames() {
+			frame.Layers[1<<6] = byte(6)
+			frame.Layers[1<<7] = byte(7)
+		}
+		var data bytes.Buffer
+		Expect(sim.WriteRendered(&data, false, 1<<6|1<<7)).To(Succeed())
+
+		readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		for _, frame := range readSim.FrameSets()[0].Frames() {
+			Expect(frame.Layers[1<<6]).To(Equal(byte(0)))
+			Expect(frame.Layers[1<<7]).To(Equal(byte(0)))
+		}
+	})
+
+	It("should report blocks its codec cannot read", func() {
+		data := write(newSim(true), temperatureFlag)
+		// the value count of the first frame, after the file header, set header and its offset
+		binary.LittleEndian.PutUint64(data[40+40:], 1<<20)
+		_, err := ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).To(Equal(InvalidData))
+	})
+})
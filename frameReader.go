@@ -0,0 +1,115 @@
+package worldDataFormat
+
+import (
+	"io"
+)
+
+/* A FrameReader hands out frames one at a time across frame set boundaries
+ * Frame sets are read and decoded in a background goroutine, up to readAhead sets ahead of Next
+ * Close must be called if the reader is abandoned before Next returns an error
+ */
+type FrameReader struct {
+	subdivisions int
+	typesRead    uint64
+	metadata     Metadata
+
+	sets     chan frameSetResult
+	stop     chan struct{}
+	isClosed bool
+
+	current []Frame
+	err     error
+}
+
+type frameSetResult struct {
+	set FrameSet
+	err error
+}
+
+// reads the file header from source and starts reading frame sets in the background
+// only the frame types in typesToRead are read
+func NewFrameReader(source io.Reader, readAhead int, typesToRead uint64) (*FrameReader, error) {
+	source = probeSeeking(source)
+	var sim WorldSimulation
+	err := sim.readHeader(source)
+	if err != nil {
+		return nil, err
+	}
+	if readAhead < 0 {
+		readAhead = 0
+	}
+
+	reader := &FrameReader{
+		subdivisions: sim.subdivisions,
+		typesRead:    sim.typesRead,
+		metadata:     sim.metadata,
+		sets:         make(chan frameSetResult, readAhead),
+		stop:         make(chan struct{}),
+	}
+	go reader.readSets(source, typesToRead)
+
+	return reader, nil
+}
+
+func (reader *FrameReader) Subdivisions() int {
+	return reader.subdivisions
+}
+
+func (reader *FrameReader) TypesRead() uint64 {
+	return reader.typesRead
+}
+
+// a copy of the metadata read from the file header
+func (reader *FrameReader) Metadata() Metadata {
+	copied, _ := reader.metadata.normalized()
+	return copied
+}
+
+// returns the next frame, or io.EOF after the last one
+func (reader *FrameReader) Next() (Frame, error) {
+	for len(reader.current) == 0 {
+		if reader.err != nil {
+			return Frame{}, reader.err
+		}
+		result := <-reader.sets
+		if result.err != nil {
+			reader.err = result.err
+		} else {
+			reader.current = result.set.Frames()
+		}
+	}
+
+	frame := reader.current[0]
+	reader.current = reader.current[1:]
+	return frame, nil
+}
+
+// stops reading ahead, the source is no longer used once the current read finishes
+func (reader *FrameReader) Close() {
+	if !reader.isClosed {
+		reader.isClosed = true
+		close(reader.stop)
+	}
+	reader.current = nil
+	if reader.err == nil {
+		reader.err = ReaderClosed
+	}
+}
+
+func (reader *FrameReader) readSets(source io.Reader, typesToRead uint64) {
+	for setIndex := 0; ; setIndex++ {
+		set, err := internalReadFrameSet(source, setIndex, reader.typesRead, typesToRead)
+		if err == nil {
+			err = set.internalDecode()
+		}
+
+		select {
+		case reader.sets <- frameSetResult{set: set, err: err}:
+		case <-reader.stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package worldDataFormat_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	. "github.com/Smerom/WorldDataFormat"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// counts seeks, each a round trip on remote sources
+type seekCounter struct {
+	*bytes.Reader
+	seeks int
+}
+
+func (counter *seekCounter) Seek(offset int64, whence int) (int64, error) {
+	counter.seeks++
+	return counter.Reader.Seek(offset, whence)
+}
+
+var _ = Describe("FrameReader", func() {
+	var data []byte
+	const frameCount = 10
+
+	BeforeEach(func() {
+		var worldSim WorldSimulation
+		worldSim.SetSubdivisions(3)
+		var set FrameSet
+		for f := 0; f < frameCount; f++ {
+			var elevations ElevationFrame
+			elevations.SetElevations([]float64{float64(f), float64(-f)})
+			set.AddFrame(Frame{Age: &AgeFrame{Age: float64(f)}, Elevations: &elevations})
+			// uneven set sizes
+			if f%4 == 2 {
+				worldSim.AddFrameSet(set)
+				set = FrameSet{}
+			}
+		}
+		worldSim.AddFrameSet(set)
+
+		var buf bytes.Buffer
+		err := worldSim.WriteRendered(&buf, true, AgeFrameFlag|ElevationFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		data = buf.Bytes()
+	})
+
+	It("should return every frame in order across frame sets", func() {
+		// hide Seek so frames are read strictly forward
+		reader, err := NewFrameReader(struct{ io.Reader }{bytes.NewReader(data)}, 2, AgeFrameFlag|ElevationFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Close()
+		Expect(reader.Subdivisions()).To(Equal(3))
+
+		for f := 0; f < frameCount; f++ {
+			frame, err := reader.Next()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.Age.Age).To(BeNumerically("==", f))
+			Expect(frame.Elevations.RenderedElevations()).To(Equal([]int16{int16(f), int16(-f)}))
+		}
+		_, err = reader.Next()
+		Expect(err).To(Equal(io.EOF))
+		_, err = reader.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("should read only the requested frame types", func() {
+		reader, err := NewFrameReader(struct{ io.Reader }{bytes.NewReader(data)}, 0, AgeFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Close()
+
+		for f := 0; f < frameCount; f++ {
+			frame, err := reader.Next()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.Age.Age).To(BeNumerically("==", f))
+			Expect(frame.Elevations).To(BeNil())
+		}
+		_, err = reader.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	// pipes implement Seek but fail it, skipped blocks must be read through
+	It("should skip frame types not requested when reading from a pipe", func() {
+		pipeReader, pipeWriter, err := os.Pipe()
+		Expect(err).ToNot(HaveOccurred())
+		defer pipeReader.Close()
+		go func() {
+			defer pipeWriter.Close()
+			pipeWriter.Write(data)
+		}()
+
+		reader, err := NewFrameReader(pipeReader, 1, AgeFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Close()
+
+		for f := 0; f < frameCount; f++ {
+			frame, err := reader.Next()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.Age.Age).To(BeNumerically("==", f))
+		}
+		_, err = reader.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("should seek once for each set to skip the frame types not requested", func() {
+		source := &seekCounter{Reader: bytes.NewReader(data)}
+		reader, err := NewFrameReader(source, 0, AgeFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Close()
+
+		for {
+			_, err = reader.Next()
+			if err != nil {
+				break
+			}
+		}
+		Expect(err).To(Equal(io.EOF))
+		// one probe, then one seek for each of the three sets
+		Expect(source.seeks).To(Equal(4))
+	})
+
+	It("should return an error for a truncated file", func() {
+		reader, err := NewFrameReader(bytes.NewReader(data[:len(data)-5]), 1, AgeFrameFlag|ElevationFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Close()
+
+		for {
+			_, err = reader.Next()
+			if err != nil {
+				break
+			}
+		}
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+	})
+
+	It("should stop returning frames once closed", func() {
+		reader, err := NewFrameReader(bytes.NewReader(data), 1, AgeFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = reader.Next()
+		Expect(err).ToNot(HaveOccurred())
+
+		reader.Close()
+		reader.Close()
+		_, err = reader.Next()
+		Expect(err).To(Equal(ReaderClosed))
+	})
+})
@@ -3,23 +3,126 @@ package worldDataFormat
 import (
 	//"log"
 	"io"
+	"io/ioutil"
 	"bytes"
 	"encoding/binary"
+	"math"
+	"math/bits"
+	"runtime"
+	"sync"
 )
 
-const FrameSetVersion = 1
+const FrameSetVersion = 2 // 2 added HeaderLength, the quantization and sea level to elevation frame headers
+
+// oldest frame set version readers understand, Upgrade rewrites older sets into FrameSetVersion
+const oldestFrameSetVersion = 1
 
 type Frame struct {
 	Elevations *ElevationFrame
 	Age *AgeFrame
 	Satallite *SatalliteFrame
+	Layers map[uint64]interface{} // frames of types registered with RegisterFrameCodec, by their flag
+}
+
+// how the frames of a set are stored, shared by every frame type
+// sets and simulations keep one with the options their setters change
+type frameEncoding struct {
+	isCompressed bool
+	isRendered bool
+	compression Compression
+	isSelfDiffed bool
+	isNeighborPredicted bool
+	isAverageDiffed bool
+	isTemporalDiffed bool
+	isXorEncoded bool
+	keyFrameInterval int // 0 when only the first frame of a set is stored without the one before it
+	quantization Quantization
+	hasChecksum bool
+	optionsSet uint64 // options whose setter was called, so a set's own choices win over its simulation's
+}
+
+// bits of frameEncoding.optionsSet
+const (
+	compressionOption = 1 << iota
+	selfDiffedOption
+	neighborPredictedOption
+	averageDiffedOption
+	temporalDiffedOption
+	xorEncodedOption
+	keyFrameIntervalOption
+	quantizationOption
+	checksumOption
+)
+
+// frame at index is stored without the frame before it
+func (options frameEncoding)isKeyFrame(index int) bool {
+	if options.keyFrameInterval > 0 {
+		return index % options.keyFrameInterval == 0
+	}
+	return index == 0
+}
+
+// what a user FrameCodec is told about the write
+func (options frameEncoding)codecOptions() FrameCodecOptions {
+	return FrameCodecOptions{IsCompressed: options.isCompressed, IsRendered: options.isRendered, Compression: options.compression}
+}
+
+// the stored options with the mode of a single write
+func (options frameEncoding)forWrite(isCompressed bool, isRendered bool) frameEncoding {
+	options.isCompressed = isCompressed
+	options.isRendered = isRendered
+	if options.optionsSet & compressionOption == 0 {
+		options.compression = DefaultCompression
+	}
+	if options.optionsSet & quantizationOption == 0 {
+		options.quantization = DefaultQuantization
+	}
+	return options
+}
+
+// a simulation's options with those set on one of its sets in their place
+func (options frameEncoding)withSetOptions(set frameEncoding) frameEncoding {
+	if set.optionsSet & compressionOption > 0 {
+		options.compression = set.compression
+	}
+	if set.optionsSet & selfDiffedOption > 0 {
+		options.isSelfDiffed = set.isSelfDiffed
+	}
+	if set.optionsSet & neighborPredictedOption > 0 {
+		options.isNeighborPredicted = set.isNeighborPredicted
+	}
+	if set.optionsSet & averageDiffedOption > 0 {
+		options.isAverageDiffed = set.isAverageDiffed
+	}
+	if set.optionsSet & temporalDiffedOption > 0 {
+		options.isTemporalDiffed = set.isTemporalDiffed
+	}
+	if set.optionsSet & xorEncodedOption > 0 {
+		options.isXorEncoded = set.isXorEncoded
+	}
+	if set.optionsSet & keyFrameIntervalOption > 0 {
+		options.keyFrameInterval = set.keyFrameInterval
+	}
+	if set.optionsSet & quantizationOption > 0 {
+		options.quantization = set.quantization
+	}
+	if set.optionsSet & checksumOption > 0 {
+		options.hasChecksum = set.hasChecksum
+	}
+	options.optionsSet |= set.optionsSet
+	return options
 }
 
 type FrameSet struct {
 	frames []Frame
 
+	encodingOptions frameEncoding
+
 	typesRead uint64
+	version uint64 // read from the header, decides the layout of the set's frames
 	typeOffsets []uint64
+	blockChecksums []uint32 // of each type block, read with HasBlockChecksumsFlag, nil without
+	dataSize uint64 // bytes of frame data following the header
 }
 
 func (set *FrameSet)AddFrame(frame Frame) {
@@ -30,27 +133,89 @@ func (set *FrameSet)Frames() []Frame {
 	return set.frames
 }
 
+// codec and level used when writing compressed, DefaultCompression if never set
+func (set *FrameSet)SetCompression(compression Compression) {
+	set.encodingOptions.compression = compression
+	set.encodingOptions.optionsSet |= compressionOption
+}
+
+// stores each elevation as its difference from the one before it, see IsSelfDiffedFlag
+func (set *FrameSet)SetSelfDiffed(isSelfDiffed bool) {
+	set.encodingOptions.isSelfDiffed = isSelfDiffed
+	set.encodingOptions.optionsSet |= selfDiffedOption
+}
+
+// self diffed rendered elevations on icosphere grids are predicted from their grid neighbours instead
+// of the value before them, see IsNeighborPredictedFlag. Frames of other lengths are unaffected
+func (set *FrameSet)SetNeighborPredicted(isNeighborPredicted bool) {
+	set.encodingOptions.isNeighborPredicted = isNeighborPredicted
+	set.encodingOptions.optionsSet |= neighborPredictedOption
+}
+
+// stores elevations as their difference from the mean of the set instead of the previous frame, see IsAverageDiffedFlag
+func (set *FrameSet)SetAverageDiffed(isAverageDiffed bool) {
+	set.encodingOptions.isAverageDiffed = isAverageDiffed
+	set.encodingOptions.optionsSet |= averageDiffedOption
+}
+
+// stores satallite colors as their difference from the frame before them, see IsTemporalDiffedFlag
+func (set *FrameSet)SetTemporalDiffed(isTemporalDiffed bool) {
+	set.encodingOptions.isTemporalDiffed = isTemporalDiffed
+	set.encodingOptions.optionsSet |= temporalDiffedOption
+}
+
+// stores full elevations XORed with the frame before them and bit packed, see IsXorEncodedFlag
+func (set *FrameSet)SetXorEncoded(isXorEncoded bool) {
+	set.encodingOptions.isXorEncoded = isXorEncoded
+	set.encodingOptions.optionsSet |= xorEncodedOption
+}
+
+// stores every interval'th frame of the set without the frame before it, so decoding any frame
+// takes at most interval decodes, see IsKeyFrameFlag. 0 turns key frames off
+func (set *FrameSet)SetKeyFrameInterval(interval int) {
+	set.encodingOptions.keyFrameInterval = interval
+	set.encodingOptions.optionsSet |= keyFrameIntervalOption
+}
+
+// how full elevations are rendered when writing rendered, DefaultQuantization if never set
+// frames read rendered keep the quantization they were written with
+func (set *FrameSet)SetQuantization(quantization Quantization) error {
+	if !quantization.isValid() {
+		return InvalidOptions
+	}
+	set.encodingOptions.quantization = quantization
+	set.encodingOptions.optionsSet |= quantizationOption
+	return nil
+}
+
+// stores a checksum with the data of every elevation and satallite frame and one for each type block of the set, verified when read
+// see HasChecksumFlag and HasBlockChecksumsFlag, the blocks cover age frames and registered FrameCodecs, which have no storage flags
+func (set *FrameSet)SetChecksummed(hasChecksum bool) {
+	set.encodingOptions.hasChecksum = hasChecksum
+	set.encodingOptions.optionsSet |= checksumOption
+}
+
 func (set *FrameSet)WriteFull(target io.Writer, isCompressed bool, typesToWrite uint64) error {
-	return set.internalWrite(target, isCompressed, false, typesToWrite)
+	return set.internalWrite(target, set.encodingOptions.forWrite(isCompressed, false), typesToWrite)
 }
 
 func (set *FrameSet)WriteRendered(target io.Writer, isCompressed bool, typesToWrite uint64) error {
-	return set.internalWrite(target, isCompressed, true, typesToWrite)
+	return set.internalWrite(target, set.encodingOptions.forWrite(isCompressed, true), typesToWrite)
 }
 
-func (set *FrameSet)writeHeader(target io.Writer, typeLengths []uint64) error {
+// blockChecksums, of each type block, are written after the offsets with HasBlockChecksumsFlag unless nil
+func (set *FrameSet)writeHeader(target io.Writer, typeLengths []uint64, blockChecksums []uint32) error {
 	var err error
 	if len(set.frames) == 0 {
 		//log.Print("No frames to write")
 		return NoData
 	}
 
+	// one offset for each type written
 	var headerSize uint64
-	headerSize = 8
-	for _, val := range typeLengths {
-		if val > 0 {
-			headerSize += 8
-		}
+	headerSize = 8 + 8*uint64(len(typeLengths))
+	if blockChecksums != nil {
+		headerSize += 8 + 4*uint64(len(blockChecksums))
 	}
 	// caculate total size, includes the 8 bytes to store to total size
 	var totalSize uint64
@@ -78,104 +243,219 @@ func (set *FrameSet)writeHeader(target io.Writer, typeLengths []uint64) error {
 	}
 	var offset uint64 = 0
 	for _, length := range typeLengths {
-		if length > 0 {
-			err = binary.Write(target, binary.LittleEndian, offset)
-			if err != nil {
-				return err
-			}
-			offset += length
+		err = binary.Write(target, binary.LittleEndian, offset)
+		if err != nil {
+			return err
+		}
+		offset += length
+	}
+	if blockChecksums != nil {
+		err = binary.Write(target, binary.LittleEndian, uint64(HasBlockChecksumsFlag))
+		if err != nil {
+			return err
+		}
+		err = binary.Write(target, binary.LittleEndian, blockChecksums)
+		if err != nil {
+			return err
 		}
 	}
-
 
 	return nil
 }
 
-func (set *FrameSet)internalWrite(target io.Writer, isCompressed bool, isRendered bool, typesToWrite uint64) error {
+func (set *FrameSet)internalWrite(target io.Writer, encoding frameEncoding, typesToWrite uint64) error {
+	return set.internalWriteEncoded(target, encoding, typesToWrite, nil)
+}
+
+// writes the set, taking the frames of types in encoded, of each type of each frame, as already encoded
+// when their codec's frames make up its block, see sizedFrameSet
+func (set *FrameSet)internalWriteEncoded(target io.Writer, encoding frameEncoding, typesToWrite uint64, encoded [][][]byte) error {
 	var err error
+	if len(set.frames) == 0 {
+		return NoData
+	}
+
+	frameTypes, err := lookupFrameTypes(typesToWrite)
+	if err != nil {
+		return err
+	}
 
 	// verify can write
-	for _, theFrame := range set.frames {
-		if (AgeFrameFlag & typesToWrite) > 0 && theFrame.Age == nil {
-			return MissingData
-		}
-		if (ElevationFrameFlag & typesToWrite) > 0 && theFrame.Elevations == nil {
-			return MissingData
-		}
-		if (SatalliteFrameFlag & typesToWrite) > 0 && theFrame.Satallite == nil {
-			return MissingData
+	for index := range set.frames {
+		for _, frameType := range frameTypes {
+			if !frameType.codec.hasFrame(&set.frames[index]) {
+				return MissingData
+			}
 		}
 	}
 
-	// write all frames to temporary buffers
-	var ageBuffer, elevationsBuffer, satalliteBuffer bytes.Buffer
-	for index, theFrame := range set.frames {
-		if (AgeFrameFlag & typesToWrite) > 0 {
-			err = theFrame.Age.internalWrite(&ageBuffer)
-			if err != nil {
-				return err
+	// each type readies its frames in bit order, then the frames of every type are encoded and compressed concurrently
+	var blocks = make([]blockWrite, len(frameTypes))
+	var jobs []func() error
+	for index, frameType := range frameTypes {
+		if encoded != nil && frameType.codec.isBlockOfFrames(encoding) {
+			blocks[index].parts = make([]bytes.Buffer, len(encoded[index]))
+			for f, data := range encoded[index] {
+				blocks[index].parts[f].Write(data)
 			}
+			continue
 		}
-		if (ElevationFrameFlag & typesToWrite) > 0 {
-			var prevFrame *ElevationFrame
-			if index == 0 {
-				prevFrame = nil
-			} else {
-				prevFrame = set.frames[index - 1].Elevations
-			}
+		blocks[index], err = frameType.codec.prepareBlock(set, encoding)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, blocks[index].jobs...)
+	}
+	err = runJobs(jobs)
+	if err != nil {
+		return err
+	}
 
-			err = theFrame.Elevations.internalWrite(&elevationsBuffer, isCompressed, isRendered, prevFrame)
-			if err != nil {
-				return err
-			}
+	// and gathered back into a block for each type, stored in bit order
+	var typeLengths []uint64
+	var blockChecksums []uint32
+	for index := range blocks {
+		typeLengths = append(typeLengths, blocks[index].size())
+		if encoding.hasChecksum {
+			blockChecksums = append(blockChecksums, blockChecksum(blocks[index].parts))
 		}
-		if (SatalliteFrameFlag & typesToWrite) > 0 {
-			err = theFrame.Satallite.internalWrite(&satalliteBuffer, isCompressed, nil)
+	}
+
+	err = set.writeHeader(target, typeLengths, blockChecksums)
+	if err != nil {
+		return err
+	}
+
+	// write the data
+	for index := range blocks {
+		for part := range blocks[index].parts {
+			_, err = blocks[index].parts[part].WriteTo(target)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	var typeLengths []uint64
-	typeLengths = append(typeLengths, uint64(ageBuffer.Len()))
-	typeLengths = append(typeLengths, uint64(elevationsBuffer.Len()))
-	typeLengths = append(typeLengths, uint64(satalliteBuffer.Len()))
+	return nil
+}
 
+// elevations the frame at index is stored as the difference from
+// the set's mean when average diffed, otherwise the frame before for rendered or XOR encoded frames after the first
+func (set *FrameSet)elevationDiffBase(index int, encoding frameEncoding, averageBasis *ElevationFrame) *ElevationFrame {
+	if encoding.isAverageDiffed {
+		return averageBasis
+	}
+	if encoding.isKeyFrame(index) || (!encoding.isRendered && !encoding.isXorEncoded) {
+		return nil
+	}
+	return set.frames[index - 1].Elevations
+}
 
-	err = set.writeHeader(target, typeLengths)
-	if err != nil {
-		return err
+// colors the frame at index is stored as the difference from, the frame before when temporal diffed
+func (set *FrameSet)satalliteDiffBase(index int, encoding frameEncoding) *SatalliteFrame {
+	if encoding.isKeyFrame(index) || !encoding.isTemporalDiffed {
+		return nil
 	}
+	return set.frames[index - 1].Satallite
+}
 
-	// write the data
-	var n int64
-	n, err = ageBuffer.WriteTo(target)
-	if err != nil {
-		return err
+// runs jobs on up to GOMAXPROCS goroutines, returning the error of the first job to fail in slice order
+func runJobs(jobs []func() error) error {
+	var errs = make([]error, len(jobs))
+	var next = make(chan int)
+	var wait sync.WaitGroup
+
+	var workerCount = runtime.GOMAXPROCS(0)
+	if workerCount > len(jobs) {
+		workerCount = len(jobs)
 	}
-	if uint64(n) != typeLengths[0] {
-		// do something!
+	for i := 0; i < workerCount; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for index := range next {
+				errs[index] = jobs[index]()
+			}
+		}()
 	}
-	n, err = elevationsBuffer.WriteTo(target)
-	if err != nil {
-		return err
+	for index := range jobs {
+		next <- index
 	}
-	if uint64(n) != typeLengths[1] {
-		// do something
+	close(next)
+	wait.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
-	n, err = satalliteBuffer.WriteTo(target)
+	return nil
+}
+
+// a set being grouped by encoded size, frames are encoded once as they are added and written as encoded where the codec allows
+type sizedFrameSet struct {
+	set        FrameSet
+	encoding   frameEncoding
+	frameTypes []registeredFrameType
+	encoded    [][][]byte // of each type, of each frame
+	size       int64
+	// kept by the elevation codec, so the mean follows the set as frames are added
+	average averageAccumulator
+}
+
+func newSizedFrameSet(encoding frameEncoding, typesToWrite uint64) (*sizedFrameSet, error) {
+	frameTypes, err := lookupFrameTypes(typesToWrite)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return &sizedFrameSet{encoding: encoding, frameTypes: frameTypes, encoded: make([][][]byte, len(frameTypes))}, nil
+}
+
+// adds the frame, returning the bytes it adds to the set's data when written after the frames before it
+func (sized *sizedFrameSet)add(frame Frame) (int64, error) {
+	sized.set.AddFrame(frame)
+	var index = len(sized.set.frames) - 1
+	var frameSize int64
+	for t, frameType := range sized.frameTypes {
+		if !frameType.codec.hasFrame(&sized.set.frames[index]) {
+			return 0, MissingData
+		}
+		data, err := frameType.codec.encodeFrame(sized, index)
+		if err != nil {
+			return 0, err
+		}
+		sized.encoded[t] = append(sized.encoded[t], data)
+		frameSize += int64(len(data))
 	}
-	if uint64(n) != typeLengths[2] {
-		// do something
+	sized.size += frameSize
+	return frameSize, nil
+}
+
+// takes back the frame added last, which starts the next set instead
+// the mean keeps it, average diffed elevations are encoded again when the set is written
+func (sized *sizedFrameSet)removeLast(frameSize int64) {
+	var last = len(sized.set.frames) - 1
+	sized.set.frames = sized.set.frames[:last]
+	for t := range sized.encoded {
+		sized.encoded[t] = sized.encoded[t][:last]
 	}
+	sized.size -= frameSize
+}
 
-	return nil
+// fewest bytes a frame can add to a set's data, 8 for each built in type, ages are the smallest
+// and a byte for user types alone, see FrameCodec
+func minimumFrameSize(typesWritten uint64) uint64 {
+	var builtInCount = uint64(bits.OnesCount64(typesWritten & (FirstUserFrameFlag - 1)))
+	if builtInCount == 0 {
+		return 1
+	}
+	return 8 * builtInCount
 }
 
-func (set *FrameSet)internalReadHeader(source io.Reader) error {
+// reads the header of a set of any version this package understands
+// one type offset is read for each type written, then the set flags and block checksums when there are any
+// fields after them from later versions are skipped
+func (set *FrameSet)internalReadHeader(source io.Reader, typesWritten uint64) error {
 	var err error
 
 	// check total size
@@ -188,11 +468,13 @@ func (set *FrameSet)internalReadHeader(source io.Reader) error {
 	}
 
 	// check version
-	var version uint64
-	err = binary.Read(source, binary.LittleEndian, &version)
+	err = binary.Read(source, binary.LittleEndian, &set.version)
 	if err != nil {
 		return err
 	}
+	if set.version < oldestFrameSetVersion || set.version > FrameSetVersion {
+		return IncompatibleVersion
+	}
 
 	// check Header Length (with only one offset)
 	var headerLen uint64
@@ -209,9 +491,17 @@ func (set *FrameSet)internalReadHeader(source io.Reader) error {
 	} else {
 		//log.Printf("Frames in frame set: %d", frameCount)
 	}
-	set.frames = make([]Frame, frameCount)
 
-	var offsetCount uint64 = (headerLen - 8)/8
+	var offsetCount = uint64(bits.OnesCount64(typesWritten))
+	if headerLen < 8 + 8*offsetCount || totalSize < 24 + headerLen {
+		return InvalidData
+	}
+	set.dataSize = totalSize - 24 - headerLen
+	// a corrupted count must not size the frames, every frame takes some of the data
+	if frameCount > set.dataSize / minimumFrameSize(typesWritten) {
+		return InvalidData
+	}
+	set.frames = make([]Frame, frameCount)
 
 	set.typeOffsets = make([]uint64, offsetCount)
 
@@ -225,41 +515,193 @@ func (set *FrameSet)internalReadHeader(source io.Reader) error {
 			//log.Printf("Type offset of: %d", set.typeOffsets[i])
 		}
 	}
-	
+	var fieldsLeft = headerLen - 8 - 8*offsetCount
+	if fieldsLeft >= 8 {
+		var setFlags uint64
+		err = binary.Read(source, binary.LittleEndian, &setFlags)
+		if err != nil {
+			return err
+		}
+		fieldsLeft -= 8
+		if setFlags & HasBlockChecksumsFlag > 0 {
+			if fieldsLeft < 4*offsetCount {
+				return InvalidData
+			}
+			set.blockChecksums = make([]uint32, offsetCount)
+			err = binary.Read(source, binary.LittleEndian, set.blockChecksums)
+			if err != nil {
+				return err
+			}
+			fieldsLeft -= 4*offsetCount
+		}
+	}
+	err = skipBytes(source, int64(fieldsLeft))
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func internalReadFrameSet(source io.Reader, typesWritten uint64) (FrameSet, error) {
+// reads the frame set, skipping the data of types written but not in typesToRead
+// setIndex is only used to name the set in errors
+func internalReadFrameSet(source io.Reader, setIndex int, typesWritten uint64, typesToRead uint64) (FrameSet, error) {
 	var readSet FrameSet
 
-	err := readSet.internalReadHeader(source)
+	err := readSet.internalReadHeader(source, typesWritten)
 	if err != nil {
 		return readSet, err
 	}
 
-	// read age frames
-	if typesWritten & AgeFrameFlag > 0 {
-		//log.Print("reading ages")
-		for index, _ := range readSet.frames {
-			ageFrame, err := internalReadAgeFrame(source)
+	// type blocks are stored in bit order, one offset for each type written
+	// blocks not read are skipped together with whatever follows them, one seek for each run
+	var position uint64 // bytes of frame data read or skipped so far
+	var blocksEnd uint64 // end of the last block, each block starts at or after it
+	var block int
+	for bit := 0; bit < 64; bit++ {
+		var flag = uint64(1) << uint(bit)
+		if typesWritten & flag == 0 {
+			continue
+		}
+		if block >= len(readSet.typeOffsets) {
+			return readSet, InvalidData
+		}
+		var blockStart = readSet.typeOffsets[block]
+		var blockEnd = readSet.dataSize
+		if block + 1 < len(readSet.typeOffsets) {
+			blockEnd = readSet.typeOffsets[block + 1]
+		}
+		if blockStart < blocksEnd || blockEnd < blockStart || blockEnd > readSet.dataSize {
+			return readSet, InvalidData
+		}
+		blocksEnd = blockEnd
+		block++
+
+		// types without a registered codec are skipped like those not asked for
+		codec, isKnown := lookupFrameType(flag)
+		if typesToRead & flag > 0 && isKnown {
+			err = skipBytes(source, int64(blockStart - position))
 			if err != nil {
 				return readSet, err
 			}
-			readSet.frames[index].Age = &ageFrame
+			var blockSource = source
+			var data []byte
+			if readSet.blockChecksums != nil {
+				data, err = readBounded(source, blockEnd - blockStart)
+				if err != nil {
+					return readSet, err
+				}
+				blockSource = bytes.NewReader(data)
+			}
+			err = codec.readBlock(blockSource, &readSet, blockEnd - blockStart)
+			// a frame naming its own mismatch is the closer error, anything else wrong with a corrupted block is put down to it
+			if _, isFrameMismatch := err.(*ChecksumError); data != nil && !isFrameMismatch {
+				blockErr := verifyBlockChecksum(data, readSet.blockChecksums[block - 1], flag)
+				if blockErr != nil {
+					err = blockErr
+				}
+			}
+			if checksumErr, ok := err.(*ChecksumError); ok {
+				checksumErr.FrameSet = setIndex
+			}
+			if err != nil {
+				return readSet, err
+			}
+			readSet.typesRead |= flag
+			position = blockEnd
 		}
 	}
 
-	// read elevation frames
-	if typesWritten & ElevationFrameFlag > 0 {
-		//log.Print("reading elevations")
-		for index, _ := range readSet.frames {
-			elevationFrame, err := internalReadElevationFrame(source)
+	// skip anything left, such as blocks not read or fields of later versions
+	err = skipToSetEnd(source, int64(readSet.dataSize - position))
+	if err != nil {
+		return readSet, err
+	}
+
+	return readSet, nil
+}
+
+// decodes the read data of every frame, in order so differenced frames build on their predecessors
+func (set *FrameSet)internalDecode() error {
+	for _, theFrame := range set.frames {
+		if theFrame.Elevations != nil {
+			err := theFrame.Elevations.Decode()
 			if err != nil {
-				return readSet, err
+				return err
 			}
-			readSet.frames[index].Elevations = &elevationFrame
+		}
+		if theFrame.Satallite != nil {
+			err := theFrame.Satallite.Decode()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// skips the rest of a set, reading its last byte so a set cut short is noticed without seeking to the end of the source
+func skipToSetEnd(source io.Reader, count int64) error {
+	if count == 0 {
+		return nil
+	}
+	err := skipBytes(source, count - 1)
+	if err != nil {
+		return err
+	}
+	var last [1]byte
+	_, err = io.ReadFull(source, last[:])
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// hides Seek from skipBytes, for sources that implement it but cannot seek
+type unseekableReader struct {
+	io.Reader
+}
+
+// source as skipBytes should see it, probed once so pipes and stdin, which fail every seek, are read through instead
+func probeSeeking(source io.Reader) io.Reader {
+	if seeker, ok := source.(io.Seeker); ok {
+		_, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return unseekableReader{source}
 		}
 	}
+	return source
+}
 
-	return readSet, nil
-}
\ No newline at end of file
+// reads length bytes the file claims follow, allocating no more than the source holds
+// so a corrupted length fails with io.ErrUnexpectedEOF instead of an allocation that cannot be made
+func readBounded(source io.Reader, length uint64) ([]byte, error) {
+	if length > math.MaxInt64 {
+		return nil, InvalidData
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(source, int64(length)))
+	if err != nil {
+		return nil, err
+	} else if uint64(len(data)) < length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+// moves source forward, seeking when possible, see probeSeeking
+// callers keep count within the header or set being read, a single seek costs one round trip on remote sources
+// but seeking past the end of a truncated file is allowed, so it is only noticed by the next read
+func skipBytes(source io.Reader, count int64) error {
+	if count == 0 {
+		return nil
+	}
+	if seeker, ok := source.(io.Seeker); ok {
+		_, err := seeker.Seek(count, io.SeekCurrent)
+		return err
+	}
+	_, err := io.CopyN(ioutil.Discard, source, count)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -140,4 +140,245 @@ var _ = Describe("FrameSet", func() {
 	        
 	    })
 	})
+
+	Context("with many frames", func() {
+		var set FrameSet
+
+		BeforeEach(func() {
+			set = FrameSet{}
+			for f := 0; f < 40; f++ {
+				var elevations ElevationFrame
+				var values []float64
+				for v := 0; v < 500; v++ {
+					values = append(values, float64(v*f%97)*10.5)
+				}
+				elevations.SetElevations(values)
+				set.AddFrame(Frame{Elevations: &elevations})
+			}
+		})
+
+		It("should lay out compressed frames in frame order", func() {
+			var data bytes.Buffer
+			err := set.WriteFull(&data, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			var expected bytes.Buffer
+			for _, frame := range set.Frames() {
+				err = frame.Elevations.WriteFull(&expected, true)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			// header of TotalSize, Version, HeaderLength, FrameCount and one offset
+			Expect(data.Bytes()[40:]).To(Equal(expected.Bytes()))
+		})
+
+		It("should write the same bytes every time", func() {
+			var first, second bytes.Buffer
+			err := set.WriteRendered(&first, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			err = set.WriteRendered(&second, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(first.Bytes()).To(Equal(second.Bytes()))
+		})
+	})
+
+	Context("self diffed", func() {
+		var set FrameSet
+		var values [][]float64
+
+		BeforeEach(func() {
+			set = FrameSet{}
+			values = nil
+			for f := 0; f < 3; f++ {
+				var frameValues []float64
+				// a smooth slope with extremes to wrap the differences around
+				for v := 0; v < 1000; v++ {
+					frameValues = append(frameValues, float64(v*3+f)+0.25)
+				}
+				frameValues = append(frameValues, -40000, 40000, -32768, 32767, 1e-300, -0)
+				values = append(values, frameValues)
+
+				var elevations ElevationFrame
+				elevations.SetElevations(frameValues)
+				set.AddFrame(Frame{Elevations: &elevations})
+			}
+		})
+
+		readFrames := func(set FrameSet, isRendered bool) []Frame {
+			var worldSim WorldSimulation
+			worldSim.SetSubdivisions(1)
+			worldSim.AddFrameSet(set)
+			var data bytes.Buffer
+			var err error
+			if isRendered {
+				err = worldSim.WriteRendered(&data, true, ElevationFrameFlag)
+			} else {
+				err = worldSim.WriteFull(&data, true, ElevationFrameFlag)
+			}
+			Expect(err).ToNot(HaveOccurred())
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			return readSim.FrameSets()[0].Frames()
+		}
+
+		It("should read back full elevations exactly", func() {
+			set.SetSelfDiffed(true)
+			for f, frame := range readFrames(set, false) {
+				Expect(frame.Elevations.Decode()).To(Succeed())
+				Expect(frame.Elevations.Elevations()).To(Equal(values[f]))
+			}
+		})
+
+		It("should read back rendered elevations exactly", func() {
+			var expected [][]int16
+			for _, frame := range set.Frames() {
+				expected = append(expected, frame.Elevations.RenderedElevations())
+			}
+			set.SetSelfDiffed(true)
+			for f, frame := range readFrames(set, true) {
+				Expect(frame.Elevations.Decode()).To(Succeed())
+				Expect(frame.Elevations.RenderedElevations()).To(Equal(expected[f]))
+			}
+		})
+
+		It("should compress smooth elevations better", func() {
+			var plain, diffed bytes.Buffer
+			err := set.WriteRendered(&plain, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			set.SetSelfDiffed(true)
+			err = set.WriteRendered(&diffed, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(diffed.Len()).To(BeNumerically("<", plain.Len()))
+		})
+	})
+
+	Context("average diffed", func() {
+		var worldSim WorldSimulation
+		var values [][]float64
+
+		BeforeEach(func() {
+			worldSim = WorldSimulation{}
+			worldSim.SetSubdivisions(1)
+			worldSim.SetAverageDiffed(true)
+			values = [][]float64{{10.5, -20, 300, 4000}, {11.5, -21, 305, 4010}, {12.25, -19, 290, 3990}}
+			var set FrameSet
+			for _, frameValues := range values {
+				var elevations ElevationFrame
+				elevations.SetElevations(frameValues)
+				set.AddFrame(Frame{Age: &AgeFrame{Age: 1}, Elevations: &elevations})
+			}
+			worldSim.AddFrameSet(set)
+		})
+
+		It("should read back full elevations exactly", func() {
+			worldSim.SetSelfDiffed(true)
+			var data bytes.Buffer
+			err := worldSim.WriteFull(&data, true, AgeFrameFlag|ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(readSim.FrameSets()[0].Frames())).To(Equal(3))
+			for f, frame := range readSim.FrameSets()[0].Frames() {
+				Expect(frame.Age.Age).To(BeNumerically("==", 1))
+				Expect(frame.Elevations.Decode()).To(Succeed())
+				Expect(frame.Elevations.Elevations()).To(Equal(values[f]))
+			}
+		})
+
+		It("should keep a corrupted frame from changing the others", func() {
+			var data bytes.Buffer
+			err := worldSim.WriteRendered(&data, false, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			// file header, set header with one offset, the mean and first frame, then the second frame's header
+			data.Bytes()[40+40+2*(64+2*4)+64] ^= 0xff
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			frames := readSim.FrameSets()[0].Frames()
+			Expect(frames[0].Elevations.RenderedElevations()).To(Equal([]int16{10, -20, 300, 4000}))
+			Expect(frames[1].Elevations.RenderedElevations()).ToNot(Equal([]int16{11, -21, 305, 4010}))
+			Expect(frames[2].Elevations.RenderedElevations()).To(Equal([]int16{12, -19, 290, 3990}))
+		})
+
+		It("should be undone when transcoded without it", func() {
+			var data bytes.Buffer
+			err := worldSim.WriteRendered(&data, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			var transcoded bytes.Buffer
+			var transcoder WorldSimulation
+			err = transcoder.ReadToWriter(bytes.NewReader(data.Bytes()), &transcoded, true, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			frames := readSim.FrameSets()[0].Frames()
+			Expect(frames[0].Elevations.RenderedElevations()).To(Equal([]int16{10, -20, 300, 4000}))
+			Expect(frames[1].Elevations.RenderedElevations()).To(Equal([]int16{11, -21, 305, 4010}))
+			Expect(frames[2].Elevations.RenderedElevations()).To(Equal([]int16{12, -19, 290, 3990}))
+		})
+	})
+
+	Context("with a key frame interval", func() {
+		var worldSim WorldSimulation
+		var rendered [][]int16
+
+		BeforeEach(func() {
+			worldSim = WorldSimulation{}
+			worldSim.SetSubdivisions(1)
+			worldSim.SetKeyFrameInterval(3)
+			worldSim.SetTemporalDiffed(true)
+			rendered = nil
+			var set FrameSet
+			for f := 0; f < 7; f++ {
+				values := []float64{float64(100 + f), float64(-200 + 2*f), float64(300 - f), float64(f * f)}
+				rendered = append(rendered, []int16{int16(100 + f), int16(-200 + 2*f), int16(300 - f), int16(f * f)})
+				var elevations ElevationFrame
+				elevations.SetElevations(values)
+				var satallite SatalliteFrame
+				satallite.SetColorsFromData([]float64{0, 0, 0, 0}, []float64{0, 0, 0, 0}, []float64{0, 0, 0, 0}, nil)
+				set.AddFrame(Frame{Elevations: &elevations, Satallite: &satallite})
+			}
+			worldSim.AddFrameSet(set)
+		})
+
+		It("should store every interval'th frame undiffed", func() {
+			var data bytes.Buffer
+			err := worldSim.WriteRendered(&data, true, ElevationFrameFlag|SatalliteFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			frames := readSim.FrameSets()[0].Frames()
+			Expect(len(frames)).To(Equal(7))
+			// frames decode out of order, back to the key frame before them
+			Expect(frames[5].Elevations.RenderedElevations()).To(Equal(rendered[5]))
+			Expect(frames[2].Elevations.Decode()).To(Succeed())
+			for f, frame := range frames {
+				Expect(frame.Elevations.IsKeyFrame()).To(Equal(f%3 == 0))
+				Expect(frame.Elevations.RenderedElevations()).To(Equal(rendered[f]))
+				Expect(frame.Satallite.Colors()).To(HaveLen(4))
+			}
+		})
+
+		It("should transcode to a different interval", func() {
+			var data bytes.Buffer
+			err := worldSim.WriteRendered(&data, false, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			var transcoded bytes.Buffer
+			var transcoder WorldSimulation
+			transcoder.SetKeyFrameInterval(2)
+			err = transcoder.ReadToWriter(bytes.NewReader(data.Bytes()), &transcoded, false, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			for f, frame := range readSim.FrameSets()[0].Frames() {
+				Expect(frame.Elevations.IsKeyFrame()).To(Equal(f%2 == 0))
+				Expect(frame.Elevations.RenderedElevations()).To(Equal(rendered[f]))
+			}
+		})
+	})
 })
@@ -0,0 +1,173 @@
+package worldDataFormat
+
+import (
+	"math"
+	"sync"
+)
+
+// the icosahedron the grid is subdivided from, vertices as in icosahedronVertices
+var icosahedronFaces = [20][3]int32{
+	{0, 11, 5}, {0, 5, 1}, {0, 1, 7}, {0, 7, 10}, {0, 10, 11},
+	{1, 5, 9}, {5, 11, 4}, {11, 10, 2}, {10, 7, 6}, {7, 1, 8},
+	{3, 9, 4}, {3, 4, 2}, {3, 2, 6}, {3, 6, 8}, {3, 8, 9},
+	{4, 9, 5}, {2, 4, 11}, {6, 2, 10}, {8, 6, 7}, {9, 8, 1},
+}
+
+// golden ratio
+const icosahedronT = 1.618033988749895
+
+var icosahedronVertices = [12][3]float64{
+	{-1, icosahedronT, 0}, {1, icosahedronT, 0}, {-1, -icosahedronT, 0}, {1, -icosahedronT, 0},
+	{0, -1, icosahedronT}, {0, 1, icosahedronT}, {0, -1, -icosahedronT}, {0, 1, -icosahedronT},
+	{icosahedronT, 0, -1}, {icosahedronT, 0, 1}, {-icosahedronT, 0, -1}, {-icosahedronT, 0, 1},
+}
+
+// grids larger than this are not predicted from their neighbours, 10*4^12+2 vertices
+const maxGridSubdivisions = 12
+
+// each subdivision splits every face, in order, into four, adding the midpoint of each edge
+// the first time the edge is met, in the order ab, bc, ca of the face (a, b, c)
+func subdivideIcosahedron(subdivisions int) ([][3]int32, [][3]float64) {
+	var faces = icosahedronFaces[:]
+	var vertices [][3]float64
+	for _, vertex := range icosahedronVertices {
+		vertices = append(vertices, normalized(vertex))
+	}
+	for level := 0; level < subdivisions; level++ {
+		var midpoints = make(map[[2]int32]int32)
+		midpoint := func(a, b int32) int32 {
+			var edge = [2]int32{a, b}
+			if b < a {
+				edge = [2]int32{b, a}
+			}
+			if index, ok := midpoints[edge]; ok {
+				return index
+			}
+			var index = int32(len(vertices))
+			midpoints[edge] = index
+			vertices = append(vertices, normalized([3]float64{
+				vertices[a][0] + vertices[b][0],
+				vertices[a][1] + vertices[b][1],
+				vertices[a][2] + vertices[b][2],
+			}))
+			return index
+		}
+		var next = make([][3]int32, 0, 4*len(faces))
+		for _, face := range faces {
+			a, b, c := face[0], face[1], face[2]
+			ab, bc, ca := midpoint(a, b), midpoint(b, c), midpoint(c, a)
+			next = append(next, [3]int32{a, ab, ca}, [3]int32{b, bc, ab}, [3]int32{c, ca, bc}, [3]int32{ab, bc, ca})
+		}
+		faces = next
+	}
+	return faces, vertices
+}
+
+func normalized(vector [3]float64) [3]float64 {
+	var length = math.Sqrt(vector[0]*vector[0] + vector[1]*vector[1] + vector[2]*vector[2])
+	return [3]float64{vector[0] / length, vector[1] / length, vector[2] / length}
+}
+
+// unit vectors of the vertices of an icosahedron subdivided subdivisions times, in the order
+// rendered elevations are predicted in, see IsNeighborPredictedFlag. Frames laid out in this order compress best
+func IcosphereVertices(subdivisions int) [][3]float64 {
+	if subdivisions < 0 || subdivisions > maxGridSubdivisions {
+		return nil
+	}
+	_, vertices := subdivideIcosahedron(subdivisions)
+	return vertices
+}
+
+// subdivisions of the icosphere with vertexCount vertices, -1 if there is none
+func icosphereSubdivisions(vertexCount int) int {
+	for subdivisions := 0; subdivisions <= maxGridSubdivisions; subdivisions++ {
+		if 10<<uint(2*subdivisions)+2 == vertexCount {
+			return subdivisions
+		}
+	}
+	return -1
+}
+
+// the neighbours of each vertex with a lower index, those already known when values are predicted in index order
+type gridTopology struct {
+	earlierStart []int32 // earlier neighbours of vertex v are earlier[earlierStart[v]:earlierStart[v+1]]
+	earlier      []int32
+}
+
+var topologyLock sync.Mutex
+var topologies = make(map[int]*gridTopology)
+
+// topology of the icosphere with vertexCount vertices, nil if there is none
+func icosphereTopology(vertexCount int) *gridTopology {
+	var subdivisions = icosphereSubdivisions(vertexCount)
+	if subdivisions < 0 {
+		return nil
+	}
+	topologyLock.Lock()
+	defer topologyLock.Unlock()
+	if topology, ok := topologies[subdivisions]; ok {
+		return topology
+	}
+
+	faces, _ := subdivideIcosahedron(subdivisions)
+	var neighbours = make([][]int32, vertexCount)
+	addEdge := func(a, b int32) {
+		if b < a {
+			a, b = b, a
+		}
+		for _, known := range neighbours[b] {
+			if known == a {
+				return
+			}
+		}
+		neighbours[b] = append(neighbours[b], a)
+	}
+	for _, face := range faces {
+		addEdge(face[0], face[1])
+		addEdge(face[1], face[2])
+		addEdge(face[2], face[0])
+	}
+	var topology = &gridTopology{earlierStart: make([]int32, vertexCount+1)}
+	for vertex, earlier := range neighbours {
+		topology.earlier = append(topology.earlier, earlier...)
+		topology.earlierStart[vertex+1] = int32(len(topology.earlier))
+	}
+	topologies[subdivisions] = topology
+	return topology
+}
+
+// the mean of the earlier neighbours of vertex truncated toward zero, or the value before it when it has none
+func (topology *gridTopology) predict(values []int32, vertex int) int32 {
+	var earlier = topology.earlier[topology.earlierStart[vertex]:topology.earlierStart[vertex+1]]
+	if len(earlier) == 0 {
+		if vertex == 0 {
+			return 0
+		}
+		return values[vertex-1]
+	}
+	var sum int64
+	for _, neighbour := range earlier {
+		sum += int64(values[neighbour])
+	}
+	return int32(sum / int64(len(earlier)))
+}
+
+// each value as its difference from its prediction, predictions are made from the values wrapped to the width as readers see them
+func (topology *gridTopology) encode(values []int32, quantization Quantization) []int32 {
+	var wrapped = make([]int32, len(values))
+	for index, value := range values {
+		wrapped[index] = quantization.wrap(value)
+	}
+	var differences = make([]int32, len(values))
+	for index, value := range wrapped {
+		differences[index] = quantization.wrap(value - topology.predict(wrapped, index))
+	}
+	return differences
+}
+
+// undoes encode in place, in index order so every prediction is made from values already decoded
+func (topology *gridTopology) decode(differences []int32, quantization Quantization) {
+	for index := range differences {
+		differences[index] = quantization.wrap(differences[index] + topology.predict(differences, index))
+	}
+}
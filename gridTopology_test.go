@@ -0,0 +1,173 @@
+package worldDataFormat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	. "github.com/Smerom/WorldDataFormat"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Grid topology", func() {
+	// smooth terrain sampled at each vertex, in the grid's own order
+	terrain := func(subdivisions int, shift float64) []float64 {
+		var elevations []float64
+		for _, vertex := range IcosphereVertices(subdivisions) {
+			x, y, z := vertex[0], vertex[1], vertex[2]
+			elevations = append(elevations, 2500*math.Sin(3*x+shift)+1500*math.Cos(2*y+z)+800*x*z)
+		}
+		return elevations
+	}
+
+	writeFrames := func(isSelfDiffed bool, isNeighborPredicted bool, frames ...[]float64) []byte {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		sim.SetSelfDiffed(isSelfDiffed)
+		sim.SetNeighborPredicted(isNeighborPredicted)
+		var set FrameSet
+		for _, values := range frames {
+			var elevations ElevationFrame
+			elevations.SetElevations(values)
+			set.AddFrame(Frame{Elevations: &elevations})
+		}
+		sim.AddFrameSet(set)
+		var data bytes.Buffer
+		Expect(sim.WriteRendered(&data, true, ElevationFrameFlag)).To(Succeed())
+		return data.Bytes()
+	}
+
+	It("should lay out 10*4^n+2 unit vertices", func() {
+		for subdivisions := 0; subdivisions < 4; subdivisions++ {
+			vertices := IcosphereVertices(subdivisions)
+			Expect(len(vertices)).To(Equal(10*int(math.Pow(4, float64(subdivisions))) + 2))
+			for _, vertex := range vertices {
+				Expect(vertex[0]*vertex[0] + vertex[1]*vertex[1] + vertex[2]*vertex[2]).To(BeNumerically("~", 1, 1e-12))
+			}
+		}
+		Expect(IcosphereVertices(-1)).To(BeNil())
+	})
+
+	// storage flags of the only frame, after the file header, set header and its offset
+	frameFlags := func(data []byte) uint64 {
+		return binary.LittleEndian.Uint64(data[40+40+8:])
+	}
+
+	It("should predict from grid neighbours on icosphere grids", func() {
+		flags := frameFlags(writeFrames(true, true, terrain(2, 0)))
+		Expect(flags & IsSelfDiffedFlag).ToNot(BeZero())
+		Expect(flags & IsNeighborPredictedFlag).ToNot(BeZero())
+
+		// any other count falls back to the value before
+		flags = frameFlags(writeFrames(true, true, terrain(2, 0)[1:]))
+		Expect(flags & IsSelfDiffedFlag).ToNot(BeZero())
+		Expect(flags & IsNeighborPredictedFlag).To(BeZero())
+	})
+
+	It("should only predict from grid neighbours when asked", func() {
+		flags := frameFlags(writeFrames(true, false, terrain(2, 0)))
+		Expect(flags & IsSelfDiffedFlag).ToNot(BeZero())
+		Expect(flags & IsNeighborPredictedFlag).To(BeZero())
+
+		// not without self diffing
+		flags = frameFlags(writeFrames(false, true, terrain(2, 0)))
+		Expect(flags & (IsSelfDiffedFlag | IsNeighborPredictedFlag)).To(BeZero())
+
+		// a set's own choice wins over its simulation's
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		sim.SetSelfDiffed(true)
+		sim.SetNeighborPredicted(true)
+		var set FrameSet
+		set.SetNeighborPredicted(false)
+		var elevations ElevationFrame
+		elevations.SetElevations(terrain(2, 0))
+		set.AddFrame(Frame{Elevations: &elevations})
+		sim.AddFrameSet(set)
+		var data bytes.Buffer
+		Expect(sim.WriteRendered(&data, false, ElevationFrameFlag)).To(Succeed())
+		Expect(frameFlags(data.Bytes()) & IsNeighborPredictedFlag).To(BeZero())
+	})
+
+	It("should compress smooth terrain in grid order better than the value before", func() {
+		values := terrain(6, 0)
+		plain := writeFrames(false, false, values)
+		previous := writeFrames(true, false, values)
+		neighbours := writeFrames(true, true, values)
+		fmt.Fprintf(GinkgoWriter, "plain %d, previous value %d, neighbours %d bytes\n", len(plain), len(previous), len(neighbours))
+		Expect(len(neighbours)).To(BeNumerically("<", len(previous)*9/10))
+		Expect(len(neighbours)).To(BeNumerically("<", len(plain)*3/4))
+
+		readSim, err := ReadWorldSimulation(bytes.NewReader(neighbours))
+		Expect(err).ToNot(HaveOccurred())
+		frame := readSim.FrameSets()[0].Frames()[0]
+		for index, value := range frame.Elevations.RenderedElevations() {
+			Expect(value).To(Equal(int16(values[index])))
+		}
+	})
+
+	for _, width := range []int{1, 2, 4} {
+		width := width
+
+		It(fmt.Sprintf("should undo predictions that wrap around, width: %d", width), func() {
+			min := -math.Pow(2, float64(8*width-1))
+			max := -min - 1
+			var first, second []float64
+			for index := 0; index < 42; index++ {
+				if index%3 == 0 {
+					first, second = append(first, min), append(second, max)
+				} else {
+					first, second = append(first, max), append(second, float64(index%2)*min)
+				}
+			}
+
+			var sim WorldSimulation
+			sim.SetSubdivisions(1)
+			sim.SetSelfDiffed(true)
+			sim.SetNeighborPredicted(true)
+			Expect(sim.SetQuantization(Quantization{Scale: 1, Width: width})).To(Succeed())
+			var set FrameSet
+			for _, values := range [][]float64{first, second, first} {
+				var elevations ElevationFrame
+				elevations.SetElevations(values)
+				set.AddFrame(Frame{Elevations: &elevations})
+			}
+			sim.AddFrameSet(set)
+			var data bytes.Buffer
+			Expect(sim.WriteRendered(&data, false, ElevationFrameFlag)).To(Succeed())
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			frames := readSim.FrameSets()[0].Frames()
+			Expect(frames[0].Elevations.ApproximateElevations()).To(Equal(first))
+			Expect(frames[1].Elevations.ApproximateElevations()).To(Equal(second))
+			Expect(frames[2].Elevations.ApproximateElevations()).To(Equal(first))
+		})
+	}
+
+	for _, isNeighborPredicted := range []bool{true, false} {
+		isNeighborPredicted := isNeighborPredicted
+
+		It(fmt.Sprintf("should transcode neighbour predicted data, predicted: %t", isNeighborPredicted), func() {
+			data := writeFrames(true, true, terrain(3, 0), terrain(3, 0.1))
+			var transcoded bytes.Buffer
+			var transcoder WorldSimulation
+			transcoder.SetSelfDiffed(true)
+			transcoder.SetNeighborPredicted(isNeighborPredicted)
+			Expect(transcoder.ReadToWriter(bytes.NewReader(data), &transcoded, false, true, ElevationFrameFlag)).To(Succeed())
+			Expect(frameFlags(transcoded.Bytes())&IsNeighborPredictedFlag > 0).To(Equal(isNeighborPredicted))
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			for f, frame := range readSim.FrameSets()[0].Frames() {
+				values := terrain(3, 0.1*float64(f))
+				for index, value := range frame.Elevations.RenderedElevations() {
+					Expect(value).To(Equal(int16(values[index])))
+				}
+			}
+		})
+	}
+})
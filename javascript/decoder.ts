@@ -5,6 +5,7 @@ class WorldSimulationDecoder {
 	subdivisionCount: number;
 	frameSetCount: number;
 	typesBitField: Uint32Array;
+	metadata: {[key: string]: string | number};
 
 	vertexCount: number;
 	vcountSet: Boolean;
@@ -18,6 +19,10 @@ class WorldSimulationDecoder {
 		this.version = initialData.getUint32(0, true);
 		this.subdivisionCount = initialData.getUint32(16, true);
 		this.frameSetCount = initialData.getUint32(24, true);
+		// all bits set when the writer could not count the sets, read until the end of the data
+		if(this.frameSetCount == 0xFFFFFFFF && initialData.getUint32(28, true) == 0xFFFFFFFF) {
+			this.frameSetCount = -1;
+		}
 
 		this.typesBitField[0] = initialData.getUint32(32, true);
 		this.typesBitField[1] = initialData.getUint32(36, true);
@@ -25,7 +30,32 @@ class WorldSimulationDecoder {
 		this.vcountSet = false;
 		this.vertexCount = 0;
 
-		this.readBytes = 40; // currently 40 byte header
+		this.readBytes = 16 + initialData.getUint32(8, true); // header length counts the fields after it
+
+		// metadata follows the types from version 3, when the header is long enough
+		this.metadata = {};
+		if(this.version >= 3 && initialData.getUint32(8, true) >= 32) {
+			let end = 48 + initialData.getUint32(40, true);
+			let position = 48;
+			let utf8 = new TextDecoder("utf-8");
+			while(position < end) {
+				let keyLength = initialData.getUint32(position, true);
+				let key = utf8.decode(new Uint8Array(initialData.buffer, initialData.byteOffset + position + 8, keyLength));
+				position += 8 + keyLength;
+				let valueType = initialData.getUint32(position, true);
+				let valueLength = initialData.getUint32(position + 8, true);
+				position += 16;
+				if(valueType == 0) {
+					this.metadata[key] = utf8.decode(new Uint8Array(initialData.buffer, initialData.byteOffset + position, valueLength));
+				} else if(valueType == 1) {
+					this.metadata[key] = initialData.getFloat64(position, true);
+				} else if(valueType == 2) {
+					// int64, exact up to 2^53
+					this.metadata[key] = initialData.getInt32(position + 4, true) * 4294967296 + initialData.getUint32(position, true);
+				}
+				position += valueLength;
+			}
+		}
 	}
 
 	setVertexCount(vcount: number) {
@@ -60,6 +90,7 @@ class FrameSetDecoder {
 	vertexCount: number;
 
 	previousFrame: Frame;
+	averageBasis: ElevationFrame;
 
 	constructor(data: DataView, typeBitField: Uint32Array, vcount: number) {
 		this.typeOffsets = new Uint32Array(numberOfTypesSet(typeBitField));
@@ -91,9 +122,11 @@ class FrameSetDecoder {
 
 		this.vertexCount = vcount;
 		this.previousFrame = null;
+		this.averageBasis = null;
 		this.readFrames = 0;
 
-		this.frameData = new DataView(data.buffer.slice(4*8 + 8*this.typeOffsets.length));
+		// header length counts the fields after it, later versions may add some after the offsets
+		this.frameData = new DataView(data.buffer.slice(24 + data.getUint32(16, true)));
 	}
 
 	nextFrame(): Frame {
@@ -112,13 +145,23 @@ class FrameSetDecoder {
 			
 			// grab elevation if applicable
 			if(isTypeFlagSet(TypeFlags.ElevationFrameFlag, this.typesBitField)) {
+				let elevationData = new DataView(this.frameData.buffer.slice(this.typeOffsets[index]));
+				// a set stored relative to its mean frame starts with the mean
+				if(isTypeFlagSet(TypeFlags.IsAverageBasisFlag, readStorageFlags(elevationData))) {
+					this.averageBasis = new ElevationFrame(elevationData, null, this.vertexCount, this.version);
+					this.typeOffsets[index] += this.averageBasis.readBytes;
+					elevationData = new DataView(this.frameData.buffer.slice(this.typeOffsets[index]));
+				}
+
 				let prevElevation: ElevationFrame
-				if(this.previousFrame != null) {
+				if(isTypeFlagSet(TypeFlags.IsAverageDiffedFlag, readStorageFlags(elevationData))) {
+					prevElevation = this.averageBasis;
+				} else if(this.previousFrame != null && !isTypeFlagSet(TypeFlags.IsKeyFrameFlag, readStorageFlags(elevationData))) {
 					prevElevation = this.previousFrame.elevations;
 				} else {
 					prevElevation = null;
 				}
-				next.elevations = new ElevationFrame(new DataView(this.frameData.buffer.slice(this.typeOffsets[index])), prevElevation, this.vertexCount);
+				next.elevations = new ElevationFrame(elevationData, prevElevation, this.vertexCount, this.version);
 				this.typeOffsets[index] += next.elevations.readBytes;
 				index++;
 			}
@@ -162,35 +205,86 @@ class AgeFrame {
 
 // rendered only
 class ElevationFrame {
-	elevations: Int16Array;
+	// quantized values, typed to the stored width so differences wrap around like the writer's
+	elevations: Int8Array | Int16Array | Int32Array;
+	// meters from sea level are elevations * scale + offset
+	scale: number;
+	offset: number;
+	sealevel: number;
 	readBytes: number;
 
-	constructor(data: DataView, prevElevations: ElevationFrame, vertexCount: number) {
+	constructor(data: DataView, prevElevations: ElevationFrame, vertexCount: number, version: number) {
 		let dataSize: number;
 		dataSize = data.getUint32(0, true)
 		
 		let storageFlags: Uint32Array;
-		storageFlags = new Uint32Array(2);
-		storageFlags[0] = data.getUint32(8, true)
-		storageFlags[1] = data.getUint32(12, true)
+		storageFlags = readStorageFlags(data);
+
+		// version 2 sets add the header length, quantization and sea level
+		let headerLength = 16;
+		let width = 2;
+		this.scale = 1;
+		this.offset = 0;
+		this.sealevel = 0;
+		if(version >= 2) {
+			headerLength = data.getUint32(16, true);
+			if(headerLength >= 56) {
+				this.scale = data.getFloat64(24, true);
+				this.offset = data.getFloat64(32, true);
+				width = data.getUint32(40, true);
+			}
+			if(headerLength >= 64) {
+				this.sealevel = data.getFloat64(56, true);
+			}
+		}
 
 		// decompress if necessary
-		let buff: Uint8Array;
+		let storedSize = withoutChecksum(dataSize, storageFlags);
+		let buff: ArrayBuffer;
 		if(isTypeFlagSet(TypeFlags.IsCompressedFlag, storageFlags)) {
 			try {
-				// inflate and convert to int 16 array
-				buff = pako.inflate(new Uint8Array(data.buffer, 16, dataSize));
-				this.elevations = new Int16Array(buff.buffer)
+				buff = inflateFrameData(new Uint8Array(data.buffer, headerLength, storedSize), storageFlags).slice().buffer;
 			} catch (err) {
 				console.log(err);
 			}
 		} else {
-			this.elevations = new Int16Array(data.buffer, 16, dataSize);
+			buff = data.buffer.slice(headerLength, headerLength + storedSize);
+		}
+		if(width == 1) {
+			this.elevations = new Int8Array(buff);
+		} else if(width == 4) {
+			this.elevations = new Int32Array(buff);
+		} else {
+			this.elevations = new Int16Array(buff);
+		}
+		// undo the difference from the previous elevation in the frame
+		if(isTypeFlagSet(TypeFlags.IsSelfDiffedFlag, storageFlags)) {
+			if(isTypeFlagSet(TypeFlags.IsNeighborPredictedFlag, storageFlags)) {
+				// or from the mean of the grid neighbours before it
+				let earlier = icosphereEarlierNeighbours(this.elevations.length);
+				for (var i = 0; i < this.elevations.length; ++i) {
+					this.elevations[i] += predictFromNeighbours(this.elevations, earlier[i], i);
+				}
+			} else {
+				for (var i = 1; i < this.elevations.length; ++i) {
+					this.elevations[i] += this.elevations[i - 1];
+				}
+			}
+		}
+		// frames after the first in a set are stored as the difference from the previous frame
+		if(prevElevations != null) {
+			for (var i = 0; i < this.elevations.length; ++i) {
+				this.elevations[i] += prevElevations.elevations[i];
+			}
 		}
-		// TODO: calculate elevations from previous frame if set
 
 		// set data read from data buffer
-		this.readBytes = dataSize + 16;
+		this.readBytes = dataSize + headerLength;
+	}
+
+	// approximate meters from sea level of vertex
+	meters(vertex: number): number {
+		return this.elevations[vertex] * this.scale + this.offset;
 	}
 }
 
@@ -210,15 +304,16 @@ class SatalliteFrame {
 		storageFlags[1] = data.getUint32(12, true)
 
 		// decompress if necessary
+		let storedSize = withoutChecksum(dataSize, storageFlags);
 		let buff: Uint8Array;
 		if(isTypeFlagSet(TypeFlags.IsCompressedFlag, storageFlags)) {
 			try {
-				buff = pako.inflate(new Uint8Array(data.buffer, 16, dataSize));
+				buff = inflateFrameData(new Uint8Array(data.buffer, 16, storedSize), storageFlags);
 			} catch (err) {
 				console.log(err);
 			}
 		} else {
-			buff = new Uint8Array(data.buffer, 16, dataSize);
+			buff = new Uint8Array(data.buffer, 16, storedSize);
 		}
 		// set data read from data buffer
 		this.readBytes = dataSize + 16;
@@ -229,6 +324,12 @@ class SatalliteFrame {
 			this.colors[i*3 + 1] = buff[i + vertexCount];
 			this.colors[i*3 + 2] = buff[i + 2*vertexCount];
 		}
+		// stored as the difference from the previous frame's colors, Uint8Array wraps around like the writer
+		if(isTypeFlagSet(TypeFlags.IsTemporalDiffedFlag, storageFlags) && prevSatallite != null) {
+			for (var i = 0; i < this.colors.length; ++i) {
+				this.colors[i] += prevSatallite.colors[i];
+			}
+		}
 	}
 }
 
@@ -238,6 +339,11 @@ enum TypeFlags {
 	ElevationFrameFlag = 1,
 	SatalliteFrameFlag = 2,
 
+	IsNeighborPredictedFlag = 50,
+	HasChecksumFlag = 51,
+	IsKeyFrameFlag = 52,
+	IsTemporalDiffedFlag = 54,
+	IsAverageBasisFlag = 55,
 	IsAverageDiffedFlag = 60,
 	IsSelfDiffedFlag = 61,
 	IsRenderedFlag = 62,
@@ -254,6 +360,108 @@ function isTypeFlagSet(flag: TypeFlags, typeField: Uint32Array): Boolean {
 	return false
 }
 
+// storage flags follow the data size in each frame header
+function readStorageFlags(data: DataView): Uint32Array {
+	let storageFlags = new Uint32Array(2);
+	storageFlags[0] = data.getUint32(8, true);
+	storageFlags[1] = data.getUint32(12, true);
+	return storageFlags;
+}
+
+// size of the frame data before its CRC32-C, which is not verified here
+function withoutChecksum(dataSize: number, storageFlags: Uint32Array): number {
+	if(isTypeFlagSet(TypeFlags.HasChecksumFlag, storageFlags)) {
+		return dataSize - 4;
+	}
+	return dataSize;
+}
+
+// the codec is stored in bits 56 to 59 of the storage flags
+function inflateFrameData(data: Uint8Array, storageFlags: Uint32Array): Uint8Array {
+	let codec: number = (storageFlags[1] >>> 24) & 0xF;
+	switch(codec) {
+		case 0: // gzip
+		case 2: // zlib
+			return pako.inflate(data);
+		case 1: // raw deflate
+			return pako.inflateRaw(data);
+		default:
+			throw "Unsupported compression codec " + codec;
+	}
+}
+
+// the icosahedron subdivided into the grid neighbour predicted elevations are laid out on
+const icosahedronFaces: number[][] = [
+	[0, 11, 5], [0, 5, 1], [0, 1, 7], [0, 7, 10], [0, 10, 11],
+	[1, 5, 9], [5, 11, 4], [11, 10, 2], [10, 7, 6], [7, 1, 8],
+	[3, 9, 4], [3, 4, 2], [3, 2, 6], [3, 6, 8], [3, 8, 9],
+	[4, 9, 5], [2, 4, 11], [6, 2, 10], [8, 6, 7], [9, 8, 1],
+];
+
+let earlierNeighbourCache: { [vertexCount: number]: number[][] } = {};
+
+// the neighbours of each vertex with a lower index, midpoints numbered as the writer does
+function icosphereEarlierNeighbours(vertexCount: number): number[][] {
+	if(earlierNeighbourCache[vertexCount] != null) {
+		return earlierNeighbourCache[vertexCount];
+	}
+	let faces = icosahedronFaces;
+	let count = 12;
+	while(count < vertexCount) {
+		let midpoints: { [edge: string]: number } = {};
+		let midpoint = function(a: number, b: number): number {
+			let edge = Math.min(a, b) + "," + Math.max(a, b);
+			if(midpoints[edge] == null) {
+				midpoints[edge] = count++;
+			}
+			return midpoints[edge];
+		};
+		let next: number[][] = [];
+		for (let face of faces) {
+			let ab = midpoint(face[0], face[1]);
+			let bc = midpoint(face[1], face[2]);
+			let ca = midpoint(face[2], face[0]);
+			next.push([face[0], ab, ca], [face[1], bc, ab], [face[2], ca, bc], [ab, bc, ca]);
+		}
+		faces = next;
+	}
+	if(count != vertexCount) {
+		throw "Neighbour predicted elevations need 10*4^n+2 vertices, not " + vertexCount;
+	}
+
+	let earlier: number[][] = [];
+	for (var i = 0; i < vertexCount; ++i) {
+		earlier.push([]);
+	}
+	let addEdge = function(a: number, b: number) {
+		let later = Math.max(a, b);
+		let lower = Math.min(a, b);
+		if(earlier[later].indexOf(lower) < 0) {
+			earlier[later].push(lower);
+		}
+	};
+	for (let face of faces) {
+		addEdge(face[0], face[1]);
+		addEdge(face[1], face[2]);
+		addEdge(face[2], face[0]);
+	}
+	earlierNeighbourCache[vertexCount] = earlier;
+	return earlier;
+}
+
+// the mean of the earlier neighbours truncated toward zero, or the value before when there are none
+function predictFromNeighbours(elevations: Int8Array | Int16Array | Int32Array, earlier: number[], vertex: number): number {
+	if(earlier.length == 0) {
+		return vertex == 0 ? 0 : elevations[vertex - 1];
+	}
+	let sum = 0;
+	for (let neighbour of earlier) {
+		sum += elevations[neighbour];
+	}
+	// within int32, so | 0 truncates toward zero
+	return (sum / earlier.length) | 0;
+}
+
 function numberOfTypesSet(typeField: Uint32Array): number {
 	let count = 0
 	// check only written types
@@ -0,0 +1,131 @@
+package worldDataFormat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+)
+
+// attributes describing a simulation, such as its name, seed, parameters or units, stored in the file header
+// values are strings, float64 or int64, int values are stored as int64
+type Metadata map[string]interface{}
+
+// how a metadata value is stored, readers skip values of types they do not know
+const (
+	metadataString = 0
+	metadataFloat  = 1
+	metadataInt    = 2
+)
+
+// copy of metadata with int values as int64, InvalidOptions for values of other types
+func (metadata Metadata) normalized() (Metadata, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	var copied = make(Metadata, len(metadata))
+	for key, value := range metadata {
+		switch typed := value.(type) {
+		case string, float64, int64:
+			copied[key] = typed
+		case int:
+			copied[key] = int64(typed)
+		default:
+			return nil, InvalidOptions
+		}
+	}
+	return copied, nil
+}
+
+// entries sorted by key, so the same metadata always writes the same bytes
+func (metadata Metadata) encode() []byte {
+	var keys []string
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var data bytes.Buffer
+	var number [8]byte
+	writeEntry := func(key string, valueType uint64, value []byte) {
+		binary.LittleEndian.PutUint64(number[:], uint64(len(key)))
+		data.Write(number[:])
+		data.WriteString(key)
+		binary.LittleEndian.PutUint64(number[:], valueType)
+		data.Write(number[:])
+		binary.LittleEndian.PutUint64(number[:], uint64(len(value)))
+		data.Write(number[:])
+		data.Write(value)
+	}
+	for _, key := range keys {
+		var value [8]byte
+		switch typed := metadata[key].(type) {
+		case string:
+			writeEntry(key, metadataString, []byte(typed))
+		case float64:
+			binary.LittleEndian.PutUint64(value[:], math.Float64bits(typed))
+			writeEntry(key, metadataFloat, value[:])
+		case int64:
+			binary.LittleEndian.PutUint64(value[:], uint64(typed))
+			writeEntry(key, metadataInt, value[:])
+		}
+	}
+	return data.Bytes()
+}
+
+func decodeMetadata(data []byte) (Metadata, error) {
+	var metadata = make(Metadata)
+	// a length prefixed field, checked against the bytes left
+	readField := func() ([]byte, error) {
+		if len(data) < 8 {
+			return nil, InvalidData
+		}
+		var length = binary.LittleEndian.Uint64(data)
+		data = data[8:]
+		if length > uint64(len(data)) {
+			return nil, InvalidData
+		}
+		var field = data[:length]
+		data = data[length:]
+		return field, nil
+	}
+	for len(data) > 0 {
+		key, err := readField()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 8 {
+			return nil, InvalidData
+		}
+		var valueType = binary.LittleEndian.Uint64(data)
+		data = data[8:]
+		value, err := readField()
+		if err != nil {
+			return nil, err
+		}
+		switch valueType {
+		case metadataString:
+			metadata[string(key)] = string(value)
+		case metadataFloat, metadataInt:
+			if len(value) != 8 {
+				return nil, InvalidData
+			}
+			if valueType == metadataFloat {
+				metadata[string(key)] = math.Float64frombits(binary.LittleEndian.Uint64(value))
+			} else {
+				metadata[string(key)] = int64(binary.LittleEndian.Uint64(value))
+			}
+		}
+	}
+	return metadata, nil
+}
+
+// reads a metadata block of length bytes, without allocating more than the source holds
+func readMetadata(source io.Reader, length uint64) (Metadata, error) {
+	data, err := readBounded(source, length)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMetadata(data)
+}
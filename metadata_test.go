@@ -0,0 +1,175 @@
+package worldDataFormat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	. "github.com/Smerom/WorldDataFormat"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metadata", func() {
+	var metadata Metadata
+
+	BeforeEach(func() {
+		metadata = Metadata{
+			"name":     "pangaea breakup",
+			"seed":     int64(-9007199254740993),
+			"steps":    40,
+			"units":    "meters",
+			"timestep": 0.5,
+			"empty":    "",
+		}
+	})
+
+	write := func(metadata Metadata) []byte {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		if metadata != nil {
+			Expect(sim.SetMetadata(metadata)).To(Succeed())
+		}
+		var set FrameSet
+		for f := 0; f < 2; f++ {
+			set.AddFrame(Frame{Age: &AgeFrame{Age: float64(f)}})
+		}
+		sim.AddFrameSet(set)
+		var data bytes.Buffer
+		Expect(sim.WriteFull(&data, false, AgeFrameFlag)).To(Succeed())
+		return data.Bytes()
+	}
+
+	// as read back, with int values as int64
+	expected := func() Metadata {
+		var read = Metadata{}
+		for key, value := range metadata {
+			read[key] = value
+		}
+		read["steps"] = int64(40)
+		return read
+	}
+
+	It("should round trip strings and numbers", func() {
+		readSim, err := ReadWorldSimulation(bytes.NewReader(write(metadata)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readSim.Metadata()).To(Equal(expected()))
+		Expect(len(readSim.FrameSets()[0].Frames())).To(Equal(2))
+	})
+
+	It("should keep the shorter header without metadata", func() {
+		data := write(nil)
+		Expect(binary.LittleEndian.Uint64(data[8:])).To(BeNumerically("==", 24))
+		readSim, err := ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readSim.Metadata()).To(BeEmpty())
+	})
+
+	It("should write the same bytes for the same metadata", func() {
+		Expect(write(metadata)).To(Equal(write(expected())))
+	})
+
+	It("should reject values that are not strings or numbers", func() {
+		var sim WorldSimulation
+		Expect(sim.SetMetadata(Metadata{"created": []byte{1}})).To(Equal(InvalidOptions))
+		Expect(sim.SetMetadata(Metadata{"ratio": float32(0.5)})).To(Equal(InvalidOptions))
+	})
+
+	It("should not be changed through the maps handed in or out", func() {
+		var sim WorldSimulation
+		Expect(sim.SetMetadata(metadata)).To(Succeed())
+		metadata["name"] = "changed"
+		sim.Metadata()["units"] = "feet"
+		Expect(sim.Metadata()["name"]).To(Equal("pangaea breakup"))
+		Expect(sim.Metadata()["units"]).To(Equal("meters"))
+	})
+
+	It("should be read by frame readers and indexes", func() {
+		data := write(metadata)
+
+		reader, err := NewFrameReader(bytes.NewReader(data), 1, AgeFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Close()
+		Expect(reader.Metadata()).To(Equal(expected()))
+
+		index, err := BuildSimulationIndex(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(index.Metadata()).To(Equal(expected()))
+		Expect(index.FrameSetCount()).To(Equal(1))
+	})
+
+	It("should be copied by transcodes unless set on the transcoder", func() {
+		data := write(metadata)
+
+		var transcoded bytes.Buffer
+		var transcoder WorldSimulation
+		Expect(transcoder.ReadToWriter(bytes.NewReader(data), &transcoded, true, false, AgeFrameFlag)).To(Succeed())
+		readSim, err := ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readSim.Metadata()).To(Equal(expected()))
+
+		transcoded.Reset()
+		transcoder = WorldSimulation{}
+		Expect(transcoder.SetMetadata(Metadata{"name": "resampled"})).To(Succeed())
+		Expect(transcoder.ReadToWriter(bytes.NewReader(data), &transcoded, true, false, AgeFrameFlag)).To(Succeed())
+		readSim, err = ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readSim.Metadata()).To(Equal(Metadata{"name": "resampled"}))
+
+		var upgraded bytes.Buffer
+		Expect(Upgrade(bytes.NewReader(data), &upgraded)).To(Succeed())
+		readSim, err = ReadWorldSimulation(bytes.NewReader(upgraded.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readSim.Metadata()).To(Equal(expected()))
+	})
+
+	It("should skip values of types it does not know", func() {
+		var data bytes.Buffer
+		entry := []interface{}{uint64(4), []byte("lost"), uint64(7), uint64(3), []byte{1, 2, 3},
+			uint64(4), []byte("name"), uint64(0), uint64(2), []byte("ok")}
+		var entries bytes.Buffer
+		for _, field := range entry {
+			Expect(binary.Write(&entries, binary.LittleEndian, field)).To(Succeed())
+		}
+		header := []uint64{3, uint64(24 + 8 + entries.Len()), 1, 0, uint64(AgeFrameFlag), uint64(entries.Len())}
+		Expect(binary.Write(&data, binary.LittleEndian, header)).To(Succeed())
+		data.Write(entries.Bytes())
+
+		readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readSim.Metadata()).To(Equal(Metadata{"name": "ok"}))
+	})
+
+	It("should be written as version 3", func() {
+		Expect(binary.LittleEndian.Uint64(write(metadata))).To(BeNumerically("==", 3))
+	})
+
+	It("should not look for metadata in version 2 headers", func() {
+		// a version 2 header with a field past the types that would read as a metadata length
+		data := write(nil)
+		var longer bytes.Buffer
+		longer.Write(data[:40])
+		binary.LittleEndian.PutUint64(longer.Bytes(), 2)
+		binary.LittleEndian.PutUint64(longer.Bytes()[8:], 24+8)
+		Expect(binary.Write(&longer, binary.LittleEndian, uint64(1<<20))).To(Succeed())
+		longer.Write(data[40:])
+
+		readSim, err := ReadWorldSimulation(bytes.NewReader(longer.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readSim.Metadata()).To(BeEmpty())
+		Expect(len(readSim.FrameSets()[0].Frames())).To(Equal(2))
+	})
+
+	It("should reject metadata longer than the header", func() {
+		data := write(metadata)
+		binary.LittleEndian.PutUint64(data[40:], binary.LittleEndian.Uint64(data[8:]))
+		_, err := ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).To(Equal(InvalidData))
+
+		data = write(metadata)
+		// an entry running past the end of the block
+		binary.LittleEndian.PutUint64(data[48:], 1<<40)
+		_, err = ReadWorldSimulation(bytes.NewReader(data))
+		Expect(err).To(Equal(InvalidData))
+	})
+})
@@ -0,0 +1,105 @@
+package worldDataFormat
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// how rendered elevations are stored, each value is (elevation - sea level - Offset) / Scale
+// truncated or rounded to an integer Width bytes wide, clamping to the range of the width
+type Quantization struct {
+	Scale     float64 // meters per step, greater than 0
+	Offset    float64 // meters from sea level stored as 0
+	Width     int     // bytes per value, 1, 2, or 4
+	IsRounded bool    // rounds to the nearest step instead of truncating toward zero
+}
+
+// used unless SetQuantization is called, whole meters from sea level as int16
+var DefaultQuantization = Quantization{Scale: 1, Offset: 0, Width: 2, IsRounded: false}
+
+func (quantization Quantization) isValid() bool {
+	if !(quantization.Scale > 0) || math.IsInf(quantization.Scale, 0) {
+		return false
+	}
+	if math.IsNaN(quantization.Offset) || math.IsInf(quantization.Offset, 0) {
+		return false
+	}
+	return quantization.Width == 1 || quantization.Width == 2 || quantization.Width == 4
+}
+
+// smallest and largest values of the width
+func (quantization Quantization) limits() (int32, int32) {
+	switch quantization.Width {
+	case 1:
+		return math.MinInt8, math.MaxInt8
+	case 2:
+		return math.MinInt16, math.MaxInt16
+	default:
+		return math.MinInt32, math.MaxInt32
+	}
+}
+
+func (quantization Quantization) quantize(fromSeaLevel float64) int32 {
+	var steps = (fromSeaLevel - quantization.Offset) / quantization.Scale
+	if quantization.IsRounded {
+		steps = math.Round(steps)
+	}
+	min, max := quantization.limits()
+	if steps < float64(min) {
+		return min
+	} else if steps > float64(max) {
+		return max
+	}
+	return int32(steps)
+}
+
+// meters from sea level a quantized value stands for
+func (quantization Quantization) meters(value int32) float64 {
+	return float64(value)*quantization.Scale + quantization.Offset
+}
+
+// value as it reads back after being stored in the width, differences wrap around on overflow
+func (quantization Quantization) wrap(value int32) int32 {
+	switch quantization.Width {
+	case 1:
+		return int32(int8(value))
+	case 2:
+		return int32(int16(value))
+	default:
+		return value
+	}
+}
+
+// little endian values, each Width bytes
+func (quantization Quantization) encodeValues(values []int32) []byte {
+	var data = make([]byte, len(values)*quantization.Width)
+	for index, value := range values {
+		switch quantization.Width {
+		case 1:
+			data[index] = byte(value)
+		case 2:
+			binary.LittleEndian.PutUint16(data[index*2:], uint16(value))
+		default:
+			binary.LittleEndian.PutUint32(data[index*4:], uint32(value))
+		}
+	}
+	return data
+}
+
+func (quantization Quantization) decodeValues(data []byte) ([]int32, error) {
+	if !quantization.isValid() || len(data)%quantization.Width != 0 {
+		return nil, InvalidData
+	}
+	var values = make([]int32, len(data)/quantization.Width)
+	for index := range values {
+		switch quantization.Width {
+		case 1:
+			values[index] = int32(int8(data[index]))
+		case 2:
+			values[index] = int32(int16(binary.LittleEndian.Uint16(data[index*2:])))
+		default:
+			values[index] = int32(binary.LittleEndian.Uint32(data[index*4:]))
+		}
+	}
+	return values, nil
+}
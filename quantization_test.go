@@ -0,0 +1,134 @@
+package worldDataFormat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	. "github.com/Smerom/WorldDataFormat"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Quantization", func() {
+	var testElev []float64 = []float64{-0.126, 0.004, 0.994, 12.345, -50000.5, 250.75}
+
+	writeAndRead := func(quantization Quantization, isSelfDiffed bool, values ...[]float64) []Frame {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		sim.SetSelfDiffed(isSelfDiffed)
+		Expect(sim.SetQuantization(quantization)).To(Succeed())
+		var set FrameSet
+		for _, frameValues := range values {
+			var elevations ElevationFrame
+			elevations.SetElevations(frameValues)
+			set.AddFrame(Frame{Elevations: &elevations})
+		}
+		sim.AddFrameSet(set)
+
+		var data bytes.Buffer
+		Expect(sim.WriteRendered(&data, true, ElevationFrameFlag)).To(Succeed())
+		readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		return readSim.FrameSets()[0].Frames()
+	}
+
+	It("should keep centimeters with a finer scale", func() {
+		quantization := Quantization{Scale: 0.01, Width: 4, IsRounded: true}
+		frames := writeAndRead(quantization, false, testElev)
+
+		Expect(frames[0].Elevations.Quantization()).To(Equal(quantization))
+		Expect(frames[0].Elevations.QuantizedElevations()).To(Equal([]int32{-13, 0, 99, 1235, -5000050, 25075}))
+		for index, value := range frames[0].Elevations.ApproximateElevations() {
+			Expect(value).To(BeNumerically("~", testElev[index], 0.005))
+		}
+	})
+
+	It("should truncate toward zero unless rounded", func() {
+		frames := writeAndRead(Quantization{Scale: 0.5, Offset: 0.25, Width: 4}, false, testElev)
+		Expect(frames[0].Elevations.QuantizedElevations()).To(Equal([]int32{0, 0, 1, 24, -100001, 501}))
+	})
+
+	It("should clamp to the width", func() {
+		frames := writeAndRead(Quantization{Scale: 100, Width: 1, IsRounded: true}, false, testElev)
+		Expect(frames[0].Elevations.QuantizedElevations()).To(Equal([]int32{0, 0, 0, 0, -128, 3}))
+		Expect(frames[0].Elevations.ApproximateElevations()).To(Equal([]float64{0, 0, 0, 0, -12800, 300}))
+	})
+
+	It("should match the previous rendering by default", func() {
+		frames := writeAndRead(DefaultQuantization, false, testElev)
+		Expect(frames[0].Elevations.RenderedElevations()).To(Equal([]int16{0, 0, 0, 12, -32768, 250}))
+	})
+
+	for _, width := range []int{1, 2, 4} {
+		width := width
+
+		It(fmt.Sprintf("should undo differences that wrap around, width: %d", width), func() {
+			quantization := Quantization{Scale: 1, Width: width}
+			min := -math.Pow(2, float64(8*width-1))
+			max := -min - 1
+			first := []float64{min, max, 0, max, min}
+			second := []float64{max, min, min, 0, max}
+
+			frames := writeAndRead(quantization, true, first, second, first)
+			Expect(frames[0].Elevations.ApproximateElevations()).To(Equal(first))
+			Expect(frames[1].Elevations.ApproximateElevations()).To(Equal(second))
+			Expect(frames[2].Elevations.ApproximateElevations()).To(Equal(first))
+		})
+	}
+
+	It("should reject invalid specs", func() {
+		var sim WorldSimulation
+		Expect(sim.SetQuantization(Quantization{Scale: 0, Width: 2})).To(Equal(InvalidOptions))
+		Expect(sim.SetQuantization(Quantization{Scale: 1, Width: 3})).To(Equal(InvalidOptions))
+		Expect(sim.SetQuantization(Quantization{Scale: math.Inf(1), Width: 2})).To(Equal(InvalidOptions))
+		var set FrameSet
+		Expect(set.SetQuantization(Quantization{Scale: 1, Offset: math.NaN(), Width: 2})).To(Equal(InvalidOptions))
+	})
+
+	It("should keep the quantization of rendered frames when transcoding", func() {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		Expect(sim.SetQuantization(Quantization{Scale: 0.01, Width: 4, IsRounded: true})).To(Succeed())
+		var set FrameSet
+		var elevations ElevationFrame
+		elevations.SetElevations(testElev)
+		set.AddFrame(Frame{Elevations: &elevations})
+		sim.AddFrameSet(set)
+		var data bytes.Buffer
+		Expect(sim.WriteRendered(&data, false, ElevationFrameFlag)).To(Succeed())
+
+		var transcoded bytes.Buffer
+		var transcoder WorldSimulation
+		err := transcoder.ReadToWriter(bytes.NewReader(data.Bytes()), &transcoded, true, true, ElevationFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+
+		readSim, err := ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		frame := readSim.FrameSets()[0].Frames()[0]
+		Expect(frame.Elevations.Quantization().Scale).To(BeNumerically("==", 0.01))
+		Expect(frame.Elevations.QuantizedElevations()).To(Equal([]int32{-13, 0, 99, 1235, -5000050, 25075}))
+	})
+
+	It("should read version 1 frame sets with the default", func() {
+		var data bytes.Buffer
+		rendered := []int16{-3, 0, 12, 32767}
+		// file header, then a set header with one offset and a frame without the quantization
+		fields := []interface{}{
+			uint64(2), uint64(24), uint64(1), uint64(1), uint64(ElevationFrameFlag),
+			uint64(24 + 16 + 16 + 2*len(rendered)), uint64(1), uint64(16), uint64(1), uint64(0),
+			uint64(2 * len(rendered)), uint64(IsRenderedFlag), rendered,
+		}
+		for _, field := range fields {
+			Expect(binary.Write(&data, binary.LittleEndian, field)).To(Succeed())
+		}
+
+		readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		frame := readSim.FrameSets()[0].Frames()[0]
+		Expect(frame.Elevations.Quantization()).To(Equal(DefaultQuantization))
+		Expect(frame.Elevations.RenderedElevations()).To(Equal(rendered))
+	})
+})
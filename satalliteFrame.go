@@ -3,10 +3,8 @@ package worldDataFormat
 import (
 	"io"
 	"log"
-	"io/ioutil"
 	"encoding/binary"
 	"bytes"
-	"compress/gzip"
 	"image"
 	_ "image/png"
 )
@@ -21,9 +19,14 @@ type SatalliteFrame struct {
 	colors []RenderedColor
 
 	data []byte
+	// frame the read colors are stored as the difference from
+	diffedFrom *SatalliteFrame
 
 	dataReadSize uint64
 	isFromCompressed bool
+	readCodec uint64
+	isFromTemporalDiffed bool
+	hasChecksum bool
 }
 
 
@@ -46,6 +49,10 @@ func (frame *SatalliteFrame)SetColorsFromData(tempurature []float64, precipitati
 	maxPrecip = 4.16
 
 	frame.colors = make([]RenderedColor, len(tempurature))
+	// any read data no longer matches
+	frame.data = nil
+	frame.diffedFrom = nil
+	frame.isFromTemporalDiffed = false
 	for i := 0; i < len(tempurature); i++ {
 		if elevations[i] > 9620 {
 			var xTemp, yPrecip int
@@ -85,16 +92,32 @@ func (frame *SatalliteFrame)SetColorsFromData(tempurature []float64, precipitati
 	}
 }
 
+// colors, decoded from read data on first access
+// nil if the read data could not be decoded, see Decode
 func (frame *SatalliteFrame)Colors() []RenderedColor {
+	if frame.colors == nil && frame.data != nil {
+		if frame.Decode() != nil {
+			return nil
+		}
+	}
 	return frame.colors
 }
 
+// decodes data read from a file, decompressing if needed
+// called on first access by Colors, exposed so read errors can be checked
+func (frame *SatalliteFrame)Decode() error {
+	if frame.data == nil || frame.colors != nil {
+		return nil
+	}
+	return frame.internalDecode()
+}
+
 func (frame *SatalliteFrame)WriteFull(target io.Writer, isCompressed bool) error {
 	return RenderedOnlyFrame
 }
 
 func (frame *SatalliteFrame)WriteRendered(target io.Writer, isCompressed bool) error {
-	return frame.internalWrite(target, isCompressed, nil)
+	return frame.internalWrite(target, frameEncoding{}.forWrite(isCompressed, true), nil)
 }
 
 func ReadSatalliteFrame(source io.Reader) (SatalliteFrame, error) {
@@ -116,66 +139,72 @@ func (frame *SatalliteFrame)writeHeader(target io.Writer, dataSize uint64, flags
 	return nil
 }
 
-func (frame *SatalliteFrame)internalWrite(target io.Writer, isCompressed bool, prevFrame *SatalliteFrame) error {
-var err error
+// decodes everything internalWrite will need from this frame and prevFrame
+// after this internalWrite only reads frame state, so frames of a set can be written concurrently
+func (frame *SatalliteFrame)internalPrepareWrite(prevFrame *SatalliteFrame) error {
+	if frame.canWriteStored(prevFrame) {
+		return nil
+	}
+	err := frame.Decode()
+	if err != nil {
+		return err
+	}
+	if prevFrame != nil {
+		return prevFrame.Decode()
+	}
+	return nil
+}
+
+// read data can be written as stored, apart from compression, if it was differenced against the same frame
+func (frame *SatalliteFrame)canWriteStored(prevFrame *SatalliteFrame) bool {
+	return len(frame.data) != 0 && frame.diffedFrom == prevFrame
+}
+
+// writes header followed by the red, green, and blue blocks
+// stored as the byte-wise difference from prevFrame's colors when not nil
+func (frame *SatalliteFrame)internalWrite(target io.Writer, encoding frameEncoding, prevFrame *SatalliteFrame) error {
+	var err error
 	if len(frame.colors) == 0 && frame.data == nil{
 		return NoData
 	}
 	var flags uint64
-	if isCompressed {
-		flags = flags | IsCompressedFlag
+	if encoding.isCompressed {
+		flags = flags | encoding.compression.storageFlags()
+	}
+	if prevFrame != nil {
+		flags = flags | IsTemporalDiffedFlag
+	} else if encoding.isTemporalDiffed && encoding.keyFrameInterval > 0 {
+		flags = flags | IsKeyFrameFlag
+	}
+	if encoding.hasChecksum {
+		flags = flags | HasChecksumFlag
 	}
 
-	// check if we have valid stored data
-	
-	//log.Print("writing from rendered")
-
-	// compress if needed
 	var dataToWrite []byte
 	// check if previously written data exists
-	if len(frame.data) != 0 {
-		if isCompressed && !frame.isFromCompressed {
-			// compress it
-			var finalizedBuffer bytes.Buffer
-			zipWriter, err := gzip.NewWriterLevel(&finalizedBuffer, gzip.BestCompression)
-			if err != nil {
-				return err
-			}
-			_, err = zipWriter.Write(frame.data)
-			if err != nil {
-				return err
-			}
-			zipWriter.Close()
-			if err != nil {
-				return err
-			}
-			dataToWrite = finalizedBuffer.Bytes()
-		} else if !isCompressed && frame.isFromCompressed {
-			// decompress it
-			zipReader, err := gzip.NewReader(bytes.NewReader(frame.data))
-			if err != nil {
-				return err
-			}
-
-			dataToWrite, err = ioutil.ReadAll(zipReader)
-			if err != nil {
-				return err
-			}
-
-		} else {
-			dataToWrite = frame.data
-		}
-
-		err = frame.writeHeader(target, uint64(len(dataToWrite)), flags)
+	if frame.canWriteStored(prevFrame) {
+		// compress or decompress if needed
+		dataToWrite, err = convertStoredData(frame.data, frame.isFromCompressed, frame.readCodec, encoding)
 		if err != nil {
 			return err
 		}
-
-		_, err = target.Write(dataToWrite)
+	} else {
+		err = frame.Decode()
 		if err != nil {
 			return err
 		}
-	} else {
+		var prevColors []RenderedColor
+		if prevFrame != nil {
+			err = prevFrame.Decode()
+			if err != nil {
+				return err
+			}
+			prevColors = prevFrame.colors
+			if len(prevColors) != len(frame.colors) {
+				return InvalidData
+			}
+		}
+
 		// we need to interlace the colors
 		var red []byte = make([]byte, len(frame.colors))
 		var green []byte = make([]byte, len(frame.colors))
@@ -186,46 +215,43 @@ var err error
 			green[index] = color.Green
 			blue[index] = color.Blue
 		}
+		// each channel wraps around independently
+		for index, prev := range prevColors {
+			red[index] -= prev.Red
+			green[index] -= prev.Green
+			blue[index] -= prev.Blue
+		}
 
 		var colorBuffer bytes.Buffer
-		_, err = colorBuffer.Write(red)
-		if err != nil {
-			return err
-		}
-		_, err = colorBuffer.Write(green)
-		if err != nil {
-			return err
-		}
-		_, err = colorBuffer.Write(blue)
-		if err != nil {
-			return err
-		}
+		colorBuffer.Write(red)
+		colorBuffer.Write(green)
+		colorBuffer.Write(blue)
 
-		if isCompressed {
-			var finalizedBuffer bytes.Buffer
-			zipWriter, err := gzip.NewWriterLevel(&finalizedBuffer, gzip.BestCompression)
-			if err != nil {
-				return err
-			}
-			_, err = colorBuffer.WriteTo(zipWriter)
-			if err != nil {
-				return err
-			}
-			zipWriter.Close()
+		if encoding.isCompressed {
+			dataToWrite, err = compressData(colorBuffer.Bytes(), encoding.compression)
 			if err != nil {
 				return err
 			}
-			dataToWrite = finalizedBuffer.Bytes()
 		} else {
 			dataToWrite = colorBuffer.Bytes()
 		}
+	}
 
-		err = frame.writeHeader(target, uint64(len(dataToWrite)), flags)
-		if err != nil {
-			return err
-		}
+	var dataSize = uint64(len(dataToWrite))
+	if encoding.hasChecksum {
+		dataSize += checksumSize
+	}
+	err = frame.writeHeader(target, dataSize, flags)
+	if err != nil {
+		return err
+	}
 
-		_, err = target.Write(dataToWrite)
+	_, err = target.Write(dataToWrite)
+	if err != nil {
+		return err
+	}
+	if encoding.hasChecksum {
+		err = writeChecksum(target, dataToWrite)
 		if err != nil {
 			return err
 		}
@@ -248,7 +274,56 @@ func (frame *SatalliteFrame)internalReadHeader(source io.Reader) error {
 	//log.Printf("Read flags as: %d", flags)
 	if flags & IsCompressedFlag > 0 {
 		frame.isFromCompressed = true
+		frame.readCodec = codecFromFlags(flags)
+	}
+	if flags & IsTemporalDiffedFlag > 0 {
+		frame.isFromTemporalDiffed = true
+	}
+	if flags & HasChecksumFlag > 0 {
+		frame.hasChecksum = true
+	}
+	return nil
+}
+
+// splits the red, green, and blue blocks of frame.data back into colors
+func (frame *SatalliteFrame)internalDecode() error {
+	var err error
+	var raw []byte
+	if frame.isFromCompressed {
+		raw, err = decompressData(frame.data, frame.readCodec)
+		if err != nil {
+			return err
+		}
+	} else {
+		raw = frame.data
+	}
+
+	if len(raw) % 3 != 0 {
+		return InvalidData
+	}
+	var vertexCount = len(raw) / 3
+	colors := make([]RenderedColor, vertexCount)
+	for index := range colors {
+		colors[index].Red = raw[index]
+		colors[index].Green = raw[vertexCount + index]
+		colors[index].Blue = raw[2*vertexCount + index]
+	}
+	// add back the colors of the frame the data was differenced from
+	if frame.diffedFrom != nil {
+		err = frame.diffedFrom.Decode()
+		if err != nil {
+			return err
+		}
+		if len(frame.diffedFrom.colors) != vertexCount {
+			return InvalidData
+		}
+		for index, prev := range frame.diffedFrom.colors {
+			colors[index].Red += prev.Red
+			colors[index].Green += prev.Green
+			colors[index].Blue += prev.Blue
+		}
 	}
+	frame.colors = colors
 	return nil
 }
 
@@ -260,13 +335,17 @@ func internalReadSatalliteFrame(source io.Reader) (SatalliteFrame, error) {
 		return frame, err
 	}
 
-	frame.data = make([]byte, frame.dataReadSize)
-
-	_, err = io.ReadFull(source, frame.data)
+	frame.data, err = readBounded(source, frame.dataReadSize)
 	if err != nil {
 		//log.Print("Error reading elevation frame")
 		return frame, err
 	}
+	if frame.hasChecksum {
+		frame.data, err = verifyChecksum(frame.data, SatalliteFrameFlag)
+		if err != nil {
+			return frame, err
+		}
+	}
 
 	return frame, nil
 }
\ No newline at end of file
@@ -1 +1,116 @@
-package worldDataFormat
\ No newline at end of file
+package worldDataFormat
+
+import (
+	"bytes"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SatalliteFrame", func() {
+	var testColors []RenderedColor = []RenderedColor{{1, 2, 3}, {255, 0, 128}, {10, 20, 30}, {0, 0, 255}}
+
+	for _, isCompressed := range []bool{false, true} {
+		isCompressed := isCompressed
+
+		It(fmt.Sprintf("should decode written colors, compressed: %t", isCompressed), func() {
+			frame := SatalliteFrame{colors: testColors}
+
+			var buf bytes.Buffer
+			err := frame.WriteRendered(&buf, isCompressed)
+			Expect(err).ToNot(HaveOccurred())
+
+			readFrame, err := ReadSatalliteFrame(&buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readFrame.Decode()).To(Succeed())
+			Expect(readFrame.Colors()).To(Equal(testColors))
+		})
+	}
+
+	It("should be read with its frame set", func() {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		var set FrameSet
+		for i := 0; i < 3; i++ {
+			set.AddFrame(Frame{Age: &AgeFrame{Age: float64(i)}, Satallite: &SatalliteFrame{colors: testColors}})
+		}
+		sim.AddFrameSet(set)
+
+		var data bytes.Buffer
+		err := sim.WriteRendered(&data, true, AgeFrameFlag|SatalliteFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+
+		// colors must pass through a transcode
+		var transcoded bytes.Buffer
+		var transcoder WorldSimulation
+		err = transcoder.ReadToWriter(bytes.NewReader(data.Bytes()), &transcoded, false, true, SatalliteFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+
+		readSim, err := ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(readSim.FrameSets())).To(Equal(1))
+		for _, frame := range readSim.FrameSets()[0].Frames() {
+			Expect(frame.Satallite).ToNot(BeNil())
+			Expect(frame.Satallite.Colors()).To(Equal(testColors))
+		}
+	})
+
+	Context("temporal diffed", func() {
+		var sim WorldSimulation
+		var frameColors [][]RenderedColor
+
+		BeforeEach(func() {
+			sim = WorldSimulation{}
+			sim.SetSubdivisions(1)
+			sim.SetTemporalDiffed(true)
+			frameColors = [][]RenderedColor{testColors, {{2, 2, 3}, {0, 255, 128}, {10, 21, 30}, {0, 0, 254}}, {{2, 3, 3}, {1, 255, 127}, {9, 21, 30}, {0, 0, 255}}}
+			var set FrameSet
+			for _, colors := range frameColors {
+				set.AddFrame(Frame{Satallite: &SatalliteFrame{colors: colors}})
+			}
+			sim.AddFrameSet(set)
+		})
+
+		It("should store frames after the first as differences", func() {
+			var data bytes.Buffer
+			err := sim.WriteRendered(&data, false, SatalliteFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			frames := readSim.FrameSets()[0].Frames()
+			Expect(frames[0].Satallite.isFromTemporalDiffed).To(BeFalse())
+			Expect(frames[1].Satallite.isFromTemporalDiffed).To(BeTrue())
+			// red and green of the second vertex wrap around between 0 and 255
+			Expect(frames[1].Satallite.data).To(Equal([]byte{1, 1, 0, 0, 0, 255, 1, 0, 0, 0, 0, 255}))
+			for f, frame := range frames {
+				Expect(frame.Satallite.Decode()).To(Succeed())
+				Expect(frame.Satallite.Colors()).To(Equal(frameColors[f]))
+			}
+		})
+
+		for _, isDiffed := range []bool{false, true} {
+			isDiffed := isDiffed
+
+			It(fmt.Sprintf("should transcode, diffed: %t", isDiffed), func() {
+				var data bytes.Buffer
+				err := sim.WriteRendered(&data, true, SatalliteFrameFlag)
+				Expect(err).ToNot(HaveOccurred())
+
+				var transcoded bytes.Buffer
+				var transcoder WorldSimulation
+				transcoder.SetTemporalDiffed(isDiffed)
+				err = transcoder.ReadToWriter(bytes.NewReader(data.Bytes()), &transcoded, false, true, SatalliteFrameFlag)
+				Expect(err).ToNot(HaveOccurred())
+
+				readSim, err := ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+				Expect(err).ToNot(HaveOccurred())
+				for f, frame := range readSim.FrameSets()[0].Frames() {
+					Expect(frame.Satallite.isFromTemporalDiffed).To(Equal(isDiffed && f > 0))
+					Expect(frame.Satallite.Colors()).To(Equal(frameColors[f]))
+				}
+			})
+		}
+	})
+})
@@ -0,0 +1,112 @@
+package worldDataFormat
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// TotalSize, Version, HeaderLength and FrameCount
+const frameSetMinimumSize = 32
+
+/* A SimulationIndex records where each frame set starts so sets can be read in any order
+ * It is built by hopping from set to set using each set's TotalSize, no frame data is read
+ * A trailing set cut short, as left by an interrupted stream write, is not indexed
+ */
+type SimulationIndex struct {
+	source       io.ReadSeeker
+	subdivisions int
+	typesRead    uint64
+	metadata     Metadata
+	setOffsets   []int64
+}
+
+// reads the file header from source and records the position of every frame set
+func BuildSimulationIndex(source io.ReadSeeker) (SimulationIndex, error) {
+	return internalBuildSimulationIndex(source)
+}
+
+func (index *SimulationIndex) FrameSetCount() int {
+	return len(index.setOffsets)
+}
+
+func (index *SimulationIndex) Subdivisions() int {
+	return index.subdivisions
+}
+
+func (index *SimulationIndex) TypesRead() uint64 {
+	return index.typesRead
+}
+
+// a copy of the metadata read from the file header
+func (index *SimulationIndex) Metadata() Metadata {
+	copied, _ := index.metadata.normalized()
+	return copied
+}
+
+// positions the source at the start of frame set n
+func (index *SimulationIndex) SeekFrameSet(n int) error {
+	if n < 0 || n >= len(index.setOffsets) {
+		return FrameSetOutOfRange
+	}
+	_, err := index.source.Seek(index.setOffsets[n], io.SeekStart)
+	return err
+}
+
+// reads frame set n, leaving the source positioned at the start of the next set
+func (index *SimulationIndex) ReadFrameSet(n int) (FrameSet, error) {
+	return index.ReadFrameSetTypes(n, ^uint64(0))
+}
+
+// reads only the frame types in typesToRead from frame set n, seeking past the data of the others
+func (index *SimulationIndex) ReadFrameSetTypes(n int, typesToRead uint64) (FrameSet, error) {
+	err := index.SeekFrameSet(n)
+	if err != nil {
+		return FrameSet{}, err
+	}
+	return internalReadFrameSet(index.source, n, index.typesRead, typesToRead)
+}
+
+func internalBuildSimulationIndex(source io.ReadSeeker) (SimulationIndex, error) {
+	var index SimulationIndex
+	index.source = source
+
+	var sim WorldSimulation
+	err := sim.readHeader(source)
+	if err != nil {
+		return index, err
+	}
+	index.subdivisions = sim.subdivisions
+	index.typesRead = sim.typesRead
+	index.metadata = sim.metadata
+
+	position, err := source.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return index, err
+	}
+	end, err := source.Seek(0, io.SeekEnd)
+	if err != nil {
+		return index, err
+	}
+
+	for end-position >= frameSetMinimumSize {
+		_, err = source.Seek(position, io.SeekStart)
+		if err != nil {
+			return index, err
+		}
+		var totalSize uint64
+		err = binary.Read(source, binary.LittleEndian, &totalSize)
+		if err != nil {
+			return index, err
+		}
+		if totalSize < frameSetMinimumSize {
+			return index, InvalidData
+		}
+		if totalSize > uint64(end-position) {
+			break // truncated
+		}
+		index.setOffsets = append(index.setOffsets, position)
+		position += int64(totalSize)
+	}
+
+	return index, nil
+}
@@ -0,0 +1,67 @@
+package worldDataFormat_test
+
+import (
+	"bytes"
+
+	. "github.com/Smerom/WorldDataFormat"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SimulationIndex", func() {
+	var data []byte
+
+	BeforeEach(func() {
+		var worldSim WorldSimulation
+		worldSim.SetSubdivisions(7)
+		for s := 0; s < 5; s++ {
+			var set FrameSet
+			for f := 0; f <= s; f++ {
+				var elevations ElevationFrame
+				elevations.SetElevations([]float64{float64(s), float64(f)})
+				set.AddFrame(Frame{Age: &AgeFrame{Age: float64(s)}, Elevations: &elevations})
+			}
+			worldSim.AddFrameSet(set)
+		}
+		var buf bytes.Buffer
+		err := worldSim.WriteRendered(&buf, true, AgeFrameFlag|ElevationFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+		data = buf.Bytes()
+	})
+
+	It("should index every frame set", func() {
+		index, err := BuildSimulationIndex(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(index.FrameSetCount()).To(Equal(5))
+		Expect(index.Subdivisions()).To(Equal(7))
+		Expect(index.TypesRead()).To(BeNumerically("==", AgeFrameFlag|ElevationFrameFlag))
+	})
+
+	It("should read frame sets in any order", func() {
+		index, err := BuildSimulationIndex(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		for _, s := range []int{4, 0, 2, 2, 1} {
+			set, err := index.ReadFrameSet(s)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(set.Frames())).To(Equal(s + 1))
+			for f, frame := range set.Frames() {
+				Expect(frame.Age.Age).To(BeNumerically("==", s))
+				Expect(frame.Elevations.RenderedElevations()).To(Equal([]int16{int16(s), int16(f)}))
+			}
+		}
+	})
+
+	It("should return an error for sets out of range", func() {
+		index, err := BuildSimulationIndex(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = index.ReadFrameSet(5)
+		Expect(err).To(Equal(FrameSetOutOfRange))
+		Expect(index.SeekFrameSet(-1)).To(Equal(FrameSetOutOfRange))
+	})
+
+	It("should skip a truncated final set", func() {
+		index, err := BuildSimulationIndex(bytes.NewReader(data[:len(data)-3]))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(index.FrameSetCount()).To(Equal(4))
+	})
+})
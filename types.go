@@ -9,5 +9,18 @@ const SatalliteFrameFlag = 1 << 2
 
 const IsCompressedFlag    = 1 << 63
 const IsRenderedFlag      = 1 << 62
-const IsSelfDiffedFlag    = 1 << 61
-const IsAverageDiffedFlag = 1 << 60
\ No newline at end of file
+const IsSelfDiffedFlag    = 1 << 61 // each elevation stored as its difference from the one before it in the grid
+const IsAverageDiffedFlag = 1 << 60 // elevations stored as their difference from the set's mean instead of the previous frame
+const IsAverageBasisFlag  = 1 << 55 // marks the mean of an average diffed set, stored ahead of its frames
+const IsTemporalDiffedFlag = 1 << 54 // satallite colors stored as their difference from the previous frame's
+const IsXorEncodedFlag    = 1 << 53 // full elevations XORed with the previous frame's and bit packed, see xorEncoding.go
+const IsKeyFrameFlag      = 1 << 52 // stored without the previous frame in a set written with a key frame interval
+const HasChecksumFlag     = 1 << 51 // data ends with its CRC32-C, see checksum.go
+const IsNeighborPredictedFlag = 1 << 50 // self diffed rendered elevations predicted from their grid neighbours, see SetNeighborPredicted and gridTopology.go
+
+// SetFlags bits of a frame set header
+const HasBlockChecksumsFlag = 1 << 63 // the CRC32-C of each type block follows the set flags, see checksum.go
+
+// StorageFlags bits naming the codec of compressed data, see compression.go
+const CompressionCodecShift = 56
+const CompressionCodecMask  = 0xF << CompressionCodecShift
@@ -0,0 +1,186 @@
+package worldDataFormat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// a frame set as stored, one block of frame data for each type written in bit order
+type storedFrameSet struct {
+	version    uint64
+	frameCount uint64
+	typeFlags  []uint64
+	blocks     [][]byte
+	// read with HasBlockChecksumsFlag, the blocks were verified and are written with checksums of what they hold then
+	hasBlockChecksums bool
+}
+
+// rewrites a set from its version into the next, by the version it is rewritten from
+var frameSetUpgrades = map[uint64]func(set *storedFrameSet) error{
+	1: upgradeFrameSetVersion1,
+}
+
+// rewrites a file of any version readers understand into the current versions
+// frame data is copied as stored, only headers whose layout changed are rewritten, so no precision is lost
+// FrameSetCount is the number of sets found, or UnknownFrameSetCount when target cannot seek back to write it
+func Upgrade(source io.Reader, target io.Writer) error {
+	source = probeSeeking(source)
+	var sim WorldSimulation
+	err := sim.readHeader(source)
+	if err != nil {
+		return err
+	}
+	// note where the target header goes if we can come back to correct its count, pipes fail the seek
+	var isTargetSeekable bool
+	var targetHeaderStart int64
+	if seeker, ok := target.(io.WriteSeeker); ok {
+		position, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			isTargetSeekable = true
+			targetHeaderStart = position
+		}
+	}
+	// stream written files can hold a stale count, so every set up to the end of the source is upgraded
+	// whatever the header says, and the count is only written once known
+	err = sim.writeHeader(target, UnknownFrameSetCount, sim.typesRead)
+	if err != nil {
+		return err
+	}
+
+	var setsUpgraded uint64
+	for {
+		set, err := readStoredFrameSet(source, sim.typesRead)
+		if checksumErr, ok := err.(*ChecksumError); ok {
+			checksumErr.FrameSet = int(setsUpgraded)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		for set.version < FrameSetVersion {
+			upgrade, ok := frameSetUpgrades[set.version]
+			if !ok {
+				return IncompatibleVersion
+			}
+			err = upgrade(&set)
+			if err != nil {
+				return err
+			}
+			set.version++
+		}
+		err = set.write(target)
+		if err != nil {
+			return err
+		}
+		setsUpgraded++
+	}
+
+	if !isTargetSeekable {
+		return nil
+	}
+	return patchFrameSetCount(target.(io.WriteSeeker), targetHeaderStart, setsUpgraded)
+}
+
+func readStoredFrameSet(source io.Reader, typesWritten uint64) (storedFrameSet, error) {
+	var set storedFrameSet
+	var header FrameSet
+	err := header.internalReadHeader(source, typesWritten)
+	if err != nil {
+		return set, err
+	}
+	set.version = header.version
+	set.frameCount = uint64(len(header.frames))
+
+	data, err := readBounded(source, header.dataSize)
+	if err != nil {
+		return set, err
+	}
+
+	for block, start := range header.typeOffsets {
+		var end = header.dataSize
+		if block+1 < len(header.typeOffsets) {
+			end = header.typeOffsets[block+1]
+		}
+		if start > end || end > header.dataSize {
+			return set, InvalidData
+		}
+		set.blocks = append(set.blocks, data[start:end])
+	}
+	for bit := 0; bit < 64; bit++ {
+		if typesWritten&(1<<uint(bit)) > 0 {
+			set.typeFlags = append(set.typeFlags, 1<<uint(bit))
+		}
+	}
+	if len(set.typeFlags) != len(set.blocks) {
+		return set, InvalidData
+	}
+	if header.blockChecksums != nil {
+		for block, checksum := range header.blockChecksums {
+			err = verifyBlockChecksum(set.blocks[block], checksum, set.typeFlags[block])
+			if err != nil {
+				return set, err
+			}
+		}
+		set.hasBlockChecksums = true
+	}
+	return set, nil
+}
+
+// writes the set with a header of the current version
+func (set *storedFrameSet) write(target io.Writer) error {
+	var typeLengths []uint64
+	var blockChecksums []uint32
+	for _, block := range set.blocks {
+		typeLengths = append(typeLengths, uint64(len(block)))
+		if set.hasBlockChecksums {
+			blockChecksums = append(blockChecksums, crc32.Checksum(block, checksumTable))
+		}
+	}
+	// the header only needs the frame count
+	var header = FrameSet{frames: make([]Frame, set.frameCount)}
+	err := header.writeHeader(target, typeLengths, blockChecksums)
+	if err != nil {
+		return err
+	}
+	for _, block := range set.blocks {
+		_, err = target.Write(block)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// version 2 added HeaderLength, the quantization and sea level to elevation frame headers
+// version 1 frames were rendered with DefaultQuantization, and their sea level was not kept
+func upgradeFrameSetVersion1(set *storedFrameSet) error {
+	for index, flag := range set.typeFlags {
+		if flag != ElevationFrameFlag {
+			continue
+		}
+		var upgraded bytes.Buffer
+		var block = set.blocks[index]
+		for len(block) > 0 {
+			if len(block) < 16 {
+				return InvalidData
+			}
+			dataSize := binary.LittleEndian.Uint64(block)
+			flags := binary.LittleEndian.Uint64(block[8:])
+			if dataSize > uint64(len(block)-16) {
+				return InvalidData
+			}
+			var frame ElevationFrame
+			err := frame.writeHeader(&upgraded, dataSize, flags, DefaultQuantization)
+			if err != nil {
+				return err
+			}
+			upgraded.Write(block[16 : 16+dataSize])
+			block = block[16+dataSize:]
+		}
+		set.blocks[index] = upgraded.Bytes()
+	}
+	return nil
+}
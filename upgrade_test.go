@@ -0,0 +1,182 @@
+package worldDataFormat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	. "github.com/Smerom/WorldDataFormat"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// a file whose sets are version 1, one age and one rendered elevation frame per set
+func versionOneFile(setCount uint64, rendered [][]int16) []byte {
+	var data bytes.Buffer
+	write := func(fields ...interface{}) {
+		for _, field := range fields {
+			Expect(binary.Write(&data, binary.LittleEndian, field)).To(Succeed())
+		}
+	}
+	write(uint64(2), uint64(24), uint64(1), setCount, uint64(AgeFrameFlag|ElevationFrameFlag))
+	for set, values := range rendered {
+		elevationSize := 16 + 2*len(values)
+		write(uint64(24+24+8+elevationSize), uint64(1), uint64(24), uint64(1), uint64(0), uint64(8))
+		write(float64(set), uint64(2*len(values)), uint64(IsRenderedFlag), values)
+	}
+	return data.Bytes()
+}
+
+var _ = Describe("Upgrade", func() {
+	var rendered = [][]int16{{-3, 0, 12, 32767}, {1, 2, 3, -32768}}
+
+	expectRendered := func(sim WorldSimulation) {
+		Expect(len(sim.FrameSets())).To(Equal(len(rendered)))
+		for set, frameSet := range sim.FrameSets() {
+			frame := frameSet.Frames()[0]
+			Expect(frame.Age.Age).To(BeNumerically("==", set))
+			Expect(frame.Elevations.Quantization()).To(Equal(DefaultQuantization))
+			Expect(frame.Elevations.RenderedElevations()).To(Equal(rendered[set]))
+		}
+	}
+
+	It("should read version 1 frame sets", func() {
+		sim, err := ReadWorldSimulation(bytes.NewReader(versionOneFile(2, rendered)))
+		Expect(err).ToNot(HaveOccurred())
+		expectRendered(sim)
+	})
+
+	// upgrades into a file, which can seek back to write the frame set count
+	upgradeToFile := func(data []byte) []byte {
+		file, err := ioutil.TempFile("", "upgrade")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.Remove(file.Name())
+		defer file.Close()
+		Expect(Upgrade(bytes.NewReader(data), file)).To(Succeed())
+		upgraded, err := ioutil.ReadFile(file.Name())
+		Expect(err).ToNot(HaveOccurred())
+		return upgraded
+	}
+
+	for _, setCount := range []uint64{2, UnknownFrameSetCount, 0} {
+		setCount := setCount
+
+		It(fmt.Sprintf("should rewrite version 1 frame sets into the current version, count: %d", setCount), func() {
+			var upgraded bytes.Buffer
+			Expect(Upgrade(bytes.NewReader(versionOneFile(setCount, rendered)), &upgraded)).To(Succeed())
+
+			// version of the first set, after the file header and its total size
+			Expect(binary.LittleEndian.Uint64(upgraded.Bytes()[40+8:])).To(BeNumerically("==", FrameSetVersion))
+			// the count is only known once every set is read
+			Expect(binary.LittleEndian.Uint64(upgraded.Bytes()[24:])).To(BeNumerically("==", UnknownFrameSetCount))
+			sim, err := ReadWorldSimulation(bytes.NewReader(upgraded.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			expectRendered(sim)
+		})
+
+		It(fmt.Sprintf("should write the number of sets found when the target can seek, count: %d", setCount), func() {
+			upgraded := upgradeToFile(versionOneFile(setCount, rendered))
+			Expect(binary.LittleEndian.Uint64(upgraded[24:])).To(BeNumerically("==", len(rendered)))
+			sim, err := ReadWorldSimulation(bytes.NewReader(upgraded))
+			Expect(err).ToNot(HaveOccurred())
+			expectRendered(sim)
+		})
+	}
+
+	It("should leave current files unchanged", func() {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		sim.SetSelfDiffed(true)
+		var set FrameSet
+		for f := 0; f < 3; f++ {
+			var elevations ElevationFrame
+			elevations.SetElevations([]float64{float64(f), 10.5, -20})
+			set.AddFrame(Frame{Age: &AgeFrame{Age: float64(f)}, Elevations: &elevations})
+		}
+		sim.AddFrameSet(set)
+		var data bytes.Buffer
+		Expect(sim.WriteRendered(&data, true, AgeFrameFlag|ElevationFrameFlag)).To(Succeed())
+
+		Expect(upgradeToFile(data.Bytes())).To(Equal(data.Bytes()))
+	})
+
+	It("should report truncated files", func() {
+		data := versionOneFile(2, rendered)
+		var upgraded bytes.Buffer
+		Expect(Upgrade(bytes.NewReader(data[:len(data)-4]), &upgraded)).ToNot(Succeed())
+	})
+
+	Context("reading headers", func() {
+		It("should reject versions it does not know", func() {
+			for _, version := range []uint64{1, WorldSimulationVersion + 1} {
+				data := versionOneFile(2, rendered)
+				binary.LittleEndian.PutUint64(data, version)
+				_, err := ReadWorldSimulation(bytes.NewReader(data))
+				Expect(err).To(Equal(IncompatibleVersion))
+			}
+
+			data := versionOneFile(2, rendered)
+			binary.LittleEndian.PutUint64(data[40+8:], FrameSetVersion+1)
+			_, err := ReadWorldSimulation(bytes.NewReader(data))
+			Expect(err).To(Equal(IncompatibleVersion))
+		})
+
+		It("should skip header fields it does not know", func() {
+			data := versionOneFile(2, rendered)
+			var longer bytes.Buffer
+			// a longer file header
+			longer.Write(data[:40])
+			binary.LittleEndian.PutUint64(longer.Bytes()[8:], 24+8)
+			longer.Write([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+			// and a longer header for the first set
+			setSize := 24 + 24 + 8 + 16 + 2*len(rendered[0])
+			set := data[40 : 40+setSize]
+			binary.Write(&longer, binary.LittleEndian, []uint64{uint64(setSize + 8), 1, 24 + 8})
+			longer.Write(set[24:48])
+			longer.Write([]byte{8, 7, 6, 5, 4, 3, 2, 1})
+			longer.Write(set[48:])
+			longer.Write(data[40+setSize:])
+
+			sim, err := ReadWorldSimulation(bytes.NewReader(longer.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			expectRendered(sim)
+		})
+
+		It("should reject frame counts the set cannot hold", func() {
+			data := versionOneFile(2, rendered)
+			// frame count of the first set, after the file header, its total size, version and header length
+			binary.LittleEndian.PutUint64(data[40+24:], 1<<60)
+			_, err := ReadWorldSimulation(bytes.NewReader(data))
+			Expect(err).To(Equal(InvalidData))
+
+			index, err := BuildSimulationIndex(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = index.ReadFrameSet(0)
+			Expect(err).To(Equal(InvalidData))
+
+			reader, err := NewFrameReader(bytes.NewReader(data), 1, AgeFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+			_, err = reader.Next()
+			Expect(err).To(Equal(InvalidData))
+		})
+
+		It("should not trust sizes past the end of the file", func() {
+			data := versionOneFile(2, rendered)
+			// total size of the first set
+			binary.LittleEndian.PutUint64(data[40:], 1<<62)
+			var upgraded bytes.Buffer
+			Expect(Upgrade(bytes.NewReader(data), &upgraded)).To(Equal(io.ErrUnexpectedEOF))
+
+			data = versionOneFile(2, rendered)
+			// data size of the last elevation frame, after its set's header and age
+			binary.LittleEndian.PutUint64(data[len(data)-16-2*len(rendered[1]):], 1<<62)
+			_, err := ReadWorldSimulation(bytes.NewReader(data))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
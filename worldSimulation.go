@@ -6,36 +6,74 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
-	"log"
 )
 
-const WorldSimulationVersion = 2
+const WorldSimulationVersion = 3
+
+// oldest file version readers understand, version 3 added metadata after TypesBitField
+// the layout of version 1 files is not recorded, so they are rejected
+const oldestWorldSimulationVersion = 2
+
+// first file version whose header can hold metadata
+const metadataWorldSimulationVersion = 3
+
+// byte position of FrameSetCount in the file header
+const frameSetCountOffset = 24
+
+// HeaderLength of a file header without metadata, SubdivisionCount, FrameSetCount and TypesBitField
+const fileHeaderMinimumLength = 24
+
+// FrameSetCount written by transcodes that regroup frames into a target they cannot seek back in
+// readers should read frame sets until the end of the file instead
+const UnknownFrameSetCount = ^uint64(0)
 
 /* There are several modes of reading and writing
  * A standard write writes only the information already given to the WorldSimulation object
  * A streaming write will write all new frame sets added, but will not retain them in memory once written
  * A streaming read will read a set number of framesets ahead of the consumption of the data, reading is always streamed, ie. files not read in full
- * When streaming for realtime consumption, the ReadToWriter method should be used
- *   Whenever a new frame should be written, call WriteNext()
+ *   Use a FrameReader for this, or ReadWorldSimulation to read the whole file into memory
+ * When transcoding a whole file at once, the ReadToWriter method should be used
+ * When streaming for realtime consumption, open the source and target with OpenTranscode
+ *   Whenever a new frame set should be written, call WriteNext()
  */
 
+// how frames read by a transcode are grouped into the frame sets written
+// one of KeepGrouping, SetCount, or SetByteSize must be set, checked in that order
+type RepackOptions struct {
+	KeepGrouping bool  // write each read set as it was
+	SetCount     int   // frames in each written set, the last may have fewer
+	SetByteSize  int64 // approximate encoded bytes of each written set, a single frame larger than this gets its own set
+	// frames are encoded once to size them and written as encoded, but average diffed elevations and FrameCodec layers
+	// are encoded again with their whole set, and a frame that does not fit again as the first of the next set
+}
+
 type WorldSimulation struct {
 	frameSets       []FrameSet
 	subdivisions    int
 	subdivisionsSet bool
+	metadata        Metadata
+	metadataSet     bool
 
 	frameSetStream      chan FrameSet
 	writeFinishedSignal chan bool
 	isStreamingWrite    bool
 
-	isCompressed bool
-	isRendered   bool
-	typesToWrite uint64
+	isCompressed    bool
+	isRendered      bool
+	typesToWrite    uint64
+	encodingOptions frameEncoding
 
-	typesRead uint64
+	typesRead         uint64
+	frameSetCountRead uint64
 
-	source io.ReadSeeker
+	source io.Reader
 	target io.Writer
+
+	// for correcting the target header once a transcode finishes
+	isTargetSeekable  bool
+	targetHeaderStart int64
+	setsRead          uint64
+	setsWritten       uint64
 }
 
 func (sim *WorldSimulation) AddFrameSet(set FrameSet) {
@@ -68,23 +106,137 @@ func (sim *WorldSimulation) Subdivisions() int {
 	return sim.subdivisions
 }
 
+// attributes written in the file header, InvalidOptions if a value is not a string, float64, int64 or int
+// transcodes copy the source's metadata unless this was called first
+func (sim *WorldSimulation) SetMetadata(metadata Metadata) error {
+	normalized, err := metadata.normalized()
+	if err != nil {
+		return err
+	}
+	sim.metadata = normalized
+	sim.metadataSet = true
+	return nil
+}
+
+// a copy of the attributes set or read, int values read back as int64
+func (sim *WorldSimulation) Metadata() Metadata {
+	copied, _ := sim.metadata.normalized()
+	return copied
+}
+
+// codec and level used when writing compressed, DefaultCompression if never set
+// applies to every set written by the simulation, including transcodes, except sets given their own
+func (sim *WorldSimulation) SetCompression(compression Compression) {
+	sim.encodingOptions.compression = compression
+	sim.encodingOptions.optionsSet |= compressionOption
+}
+
+// stores each elevation as its difference from the one before it, see IsSelfDiffedFlag
+func (sim *WorldSimulation) SetSelfDiffed(isSelfDiffed bool) {
+	sim.encodingOptions.isSelfDiffed = isSelfDiffed
+}
+
+// predicts self diffed rendered elevations on icosphere grids from their grid neighbours, see FrameSet.SetNeighborPredicted
+func (sim *WorldSimulation) SetNeighborPredicted(isNeighborPredicted bool) {
+	sim.encodingOptions.isNeighborPredicted = isNeighborPredicted
+}
+
+// stores elevations as their difference from the mean of their set instead of the previous frame, see IsAverageDiffedFlag
+func (sim *WorldSimulation) SetAverageDiffed(isAverageDiffed bool) {
+	sim.encodingOptions.isAverageDiffed = isAverageDiffed
+}
+
+// stores satallite colors as their difference from the frame before them, see IsTemporalDiffedFlag
+func (sim *WorldSimulation) SetTemporalDiffed(isTemporalDiffed bool) {
+	sim.encodingOptions.isTemporalDiffed = isTemporalDiffed
+}
+
+// stores full elevations XORed with the frame before them and bit packed, see IsXorEncodedFlag
+func (sim *WorldSimulation) SetXorEncoded(isXorEncoded bool) {
+	sim.encodingOptions.isXorEncoded = isXorEncoded
+}
+
+// how full elevations are rendered when writing rendered, see FrameSet.SetQuantization
+func (sim *WorldSimulation) SetQuantization(quantization Quantization) error {
+	if !quantization.isValid() {
+		return InvalidOptions
+	}
+	sim.encodingOptions.quantization = quantization
+	sim.encodingOptions.optionsSet |= quantizationOption
+	return nil
+}
+
+// stores a checksum with the data of every elevation and satallite frame and each type block of every set, see FrameSet.SetChecksummed
+func (sim *WorldSimulation) SetChecksummed(hasChecksum bool) {
+	sim.encodingOptions.hasChecksum = hasChecksum
+}
+
+// stores every interval'th frame of each set without the frame before it, see IsKeyFrameFlag
+func (sim *WorldSimulation) SetKeyFrameInterval(interval int) {
+	sim.encodingOptions.keyFrameInterval = interval
+}
+
+// frame types stored in the file the simulation was read from
+func (sim *WorldSimulation) TypesRead() uint64 {
+	return sim.typesRead
+}
+
+// reads the file header and every frame set from source into memory
+func ReadWorldSimulation(source io.ReadSeeker) (WorldSimulation, error) {
+	return internalReadWorldSimulation(source, ^uint64(0))
+}
+
+// reads only the frame types in typesToRead, seeking past the data of the others
+func ReadWorldSimulationTypes(source io.ReadSeeker, typesToRead uint64) (WorldSimulation, error) {
+	return internalReadWorldSimulation(source, typesToRead)
+}
+
 func (sim *WorldSimulation) WriteFull(target io.Writer, isCompressed bool, typesToWrite uint64) error {
-	return sim.internalWrite(target, isCompressed, false, typesToWrite)
+	return sim.internalWrite(target, uint64(len(sim.frameSets)), isCompressed, false, typesToWrite)
 }
 
-// func (sim *WorldSimulation) WriteNext() error {
-// 	return sim.internalWriteNext()
-// }
+// transcodes the next frame set from the source given to OpenTranscode
+// returns io.EOF once every set has been written
+func (sim *WorldSimulation) WriteNext() error {
+	return sim.internalWriteNext()
+}
 
 func (sim *WorldSimulation) WriteRendered(target io.Writer, isCompressed bool, typesToWrite uint64) error {
-	return sim.internalWrite(target, isCompressed, true, typesToWrite)
+	return sim.internalWrite(target, uint64(len(sim.frameSets)), isCompressed, true, typesToWrite)
+}
+
+// reads the header of source and writes the header of target, frame sets are then transcoded one at a time by WriteNext
+func (sim *WorldSimulation) OpenTranscode(source io.Reader, target io.Writer, isCompressed, isRendered bool, typesToWrite uint64) error {
+	err := sim.internalOpenTranscode(source, target, isCompressed, isRendered, typesToWrite)
+	if err != nil {
+		return err
+	}
+	// sets are transcoded one to one, so the source count holds
+	return sim.writeHeader(target, sim.frameSetCountRead, typesToWrite)
 }
 
+// transcodes every frame set of source to target, regrouping frames into sets of 30
 func (sim *WorldSimulation) ReadToWriter(source io.ReadSeeker, target io.Writer, isCompressed, isRendered bool, typesToWrite uint64) error {
-	return sim.internalReadToWriter(source, target, 30, isCompressed, isRendered, typesToWrite)
+	return sim.internalReadToWriter(source, target, RepackOptions{SetCount: 30}, isCompressed, isRendered, typesToWrite)
+}
+
+// transcodes every frame set of source to target, grouping frames into sets as set by repack
+func (sim *WorldSimulation) RepackToWriter(source io.Reader, target io.Writer, repack RepackOptions, isCompressed, isRendered bool, typesToWrite uint64) error {
+	return sim.internalReadToWriter(source, target, repack, isCompressed, isRendered, typesToWrite)
 }
 
+// writes frame sets as loss-less float64s as they are added, until FlushAndCloseWriteStream is called
+// targets that cannot seek back, such as pipes, are left with UnknownFrameSetCount in the header
+func (sim *WorldSimulation) StreamWriteFull(target io.WriteSeeker, isCompressed bool, typesToWrite uint64) chan error {
+	return sim.startStreamWrite(target, isCompressed, false, typesToWrite)
+}
+
+// writes rendered frame sets as they are added, until FlushAndCloseWriteStream is called, see StreamWriteFull
 func (sim *WorldSimulation) StreamWriteRendered(target io.WriteSeeker, isCompressed bool, typesToWrite uint64) chan error {
+	return sim.startStreamWrite(target, isCompressed, true, typesToWrite)
+}
+
+func (sim *WorldSimulation) startStreamWrite(target io.WriteSeeker, isCompressed, isRendered bool, typesToWrite uint64) chan error {
 	sim.frameSetStream = make(chan FrameSet, 1)
 	sim.isStreamingWrite = true
 
@@ -94,7 +246,7 @@ func (sim *WorldSimulation) StreamWriteRendered(target io.WriteSeeker, isCompres
 	sim.writeFinishedSignal = make(chan bool, 1)
 
 	go func() {
-		err := sim.internalStreamWrite(target, isCompressed, true, typesToWrite)
+		err := sim.internalStreamWrite(target, isCompressed, isRendered, typesToWrite)
 		// log.Printf("Error on sim?: %s", err)
 		errChan <- err
 		close(errChan)
@@ -102,13 +254,20 @@ func (sim *WorldSimulation) StreamWriteRendered(target io.WriteSeeker, isCompres
 	return errChan
 }
 
-func (sim *WorldSimulation) writeHeader(target io.Writer, typesToWrite uint64) error {
+func (sim *WorldSimulation) writeHeader(target io.Writer, frameSetCount uint64, typesToWrite uint64) error {
 	var err error
 	err = binary.Write(target, binary.LittleEndian, uint64(WorldSimulationVersion))
 	if err != nil {
 		return err
 	}
-	err = binary.Write(target, binary.LittleEndian, uint64(24))
+	// files without metadata keep the shorter header
+	var metadata []byte
+	var length uint64 = fileHeaderMinimumLength
+	if len(sim.metadata) > 0 {
+		metadata = sim.metadata.encode()
+		length += 8 + uint64(len(metadata))
+	}
+	err = binary.Write(target, binary.LittleEndian, length)
 	if err != nil {
 		return err
 	}
@@ -116,7 +275,7 @@ func (sim *WorldSimulation) writeHeader(target io.Writer, typesToWrite uint64) e
 	if err != nil {
 		return err
 	}
-	err = binary.Write(target, binary.LittleEndian, uint64(len(sim.frameSets)))
+	err = binary.Write(target, binary.LittleEndian, frameSetCount)
 	if err != nil {
 		return err
 	}
@@ -124,24 +283,35 @@ func (sim *WorldSimulation) writeHeader(target io.Writer, typesToWrite uint64) e
 	if err != nil {
 		return err
 	}
+	if len(sim.metadata) > 0 {
+		err = binary.Write(target, binary.LittleEndian, uint64(len(metadata)))
+		if err != nil {
+			return err
+		}
+		_, err = target.Write(metadata)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (sim *WorldSimulation) internalWrite(target io.Writer, isCompressed bool, isRendered bool, typesToWrite uint64) error {
+// writes the header, with frameSetCount, and the sets added so far
+func (sim *WorldSimulation) internalWrite(target io.Writer, frameSetCount uint64, isCompressed bool, isRendered bool, typesToWrite uint64) error {
 	var err error
 
 	if sim.subdivisionsSet == false {
 		return MissingGridDefinition
 	}
 
-	err = sim.writeHeader(target, typesToWrite)
+	err = sim.writeHeader(target, frameSetCount, typesToWrite)
 	if err != nil {
 		return err
 	}
 
 	// write each frameset
 	for _, set := range sim.frameSets {
-		err = set.internalWrite(target, isCompressed, isRendered, typesToWrite)
+		err = set.internalWrite(target, sim.encodingOptions.withSetOptions(set.encodingOptions).forWrite(isCompressed, isRendered), typesToWrite)
 		if err != nil {
 			return err
 		}
@@ -150,68 +320,158 @@ func (sim *WorldSimulation) internalWrite(target io.Writer, isCompressed bool, i
 	return nil
 }
 
-func (sim *WorldSimulation) internalWriteNext() error {
-	var err error
+func (sim *WorldSimulation) internalOpenTranscode(source io.Reader, target io.Writer, isCompressed, isRendered bool, typesToWrite uint64) error {
+	source = probeSeeking(source)
+	sim.source = source
+	sim.target = target
+	sim.isCompressed = isCompressed
+	sim.isRendered = isRendered
+	sim.typesToWrite = typesToWrite
 
-	set, err := internalReadFrameSet(sim.source, sim.typesRead)
-	if err != nil {
-		log.Printf("Error reading set: %s", err)
-		return NoData
+	sim.setsRead = 0
+	sim.setsWritten = 0
+
+	// note where the target header goes if we can come back to correct it, pipes fail the seek
+	sim.isTargetSeekable = false
+	if seeker, ok := target.(io.WriteSeeker); ok {
+		position, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			sim.isTargetSeekable = true
+			sim.targetHeaderStart = position
+		}
 	}
 
-	//log.Print("Writing next set from stream")
+	return sim.readHeader(source)
+}
 
-	err = set.internalWrite(sim.target, sim.isCompressed, sim.isRendered, sim.typesToWrite)
+// reads the next set to transcode, counting it for errors
+func (sim *WorldSimulation) readTranscodedSet() (FrameSet, error) {
+	set, err := internalReadFrameSet(sim.source, int(sim.setsRead), sim.typesRead, sim.typesToWrite)
 	if err != nil {
-		return err
+		return set, err
 	}
+	sim.setsRead++
+	return set, nil
+}
 
+// writes a transcoded set, counting it for the header, encoded holds frames already encoded if any, see sizedFrameSet
+func (sim *WorldSimulation) writeTranscodedSet(set *FrameSet, encoded [][][]byte) error {
+	err := set.internalWriteEncoded(sim.target, sim.encodingOptions.withSetOptions(set.encodingOptions).forWrite(sim.isCompressed, sim.isRendered), sim.typesToWrite, encoded)
+	if err != nil {
+		return err
+	}
+	sim.setsWritten++
 	return nil
 }
 
-func (sim *WorldSimulation) internalStreamWrite(target io.WriteSeeker, isCompressed bool, isRendered bool, typesToWrite uint64) error {
+// corrects the target header with the number of sets written, if the target can seek
+func (sim *WorldSimulation) finishTranscode() error {
+	if !sim.isTargetSeekable {
+		return nil
+	}
+	return patchFrameSetCount(sim.target.(io.WriteSeeker), sim.targetHeaderStart, sim.setsWritten)
+}
+
+func (sim *WorldSimulation) internalWriteNext() error {
+	var err error
+
+	if sim.source == nil || sim.target == nil {
+		return NoSource
+	}
+
+	set, err := sim.readTranscodedSet()
+	if err == io.EOF {
+		err = sim.finishTranscode()
+		if err != nil {
+			return err
+		}
+		return io.EOF
+	} else if err != nil {
+		return err
+	}
+
+	//log.Print("Writing next set from stream")
+
+	return sim.writeTranscodedSet(&set, nil)
+}
+
+func (sim *WorldSimulation) internalStreamWrite(target io.WriteSeeker, isCompressed bool, isRendered bool, typesToWrite uint64) (err error) {
 	// always signal write finished when exiting this function
 	defer func() {
+		// sets still added after an error are taken and dropped, so AddFrameSet and FlushAndCloseWriteStream never block
+		if err != nil && sim.frameSetStream != nil {
+			for range sim.frameSetStream {
+			}
+		}
 		sim.writeFinishedSignal <- true // indicate that all sets are finished writing
 		close(sim.writeFinishedSignal)
 	}()
 	if sim.frameSetStream == nil || !sim.isStreamingWrite {
 		return errors.New("Not set up to stream sets")
 	}
+	// remember where the header is so the frame set count can be corrected once streaming ends
+	// pipes fail the seek, their header keeps an unknown count
+	var setCount = uint64(len(sim.frameSets))
+	var headerCount = setCount
+	headerStart, seekErr := target.Seek(0, io.SeekCurrent)
+	if seekErr != nil {
+		headerCount = UnknownFrameSetCount
+	}
 	// write any previously added frames
-	var err error
-	err = sim.internalWrite(target, isCompressed, isRendered, typesToWrite)
+	err = sim.internalWrite(target, headerCount, isCompressed, isRendered, typesToWrite)
 	if err != nil {
 		return err
 	}
 
 	for set := range sim.frameSetStream {
-		err = set.internalWrite(target, isCompressed, isRendered, typesToWrite)
+		err = set.internalWrite(target, sim.encodingOptions.withSetOptions(set.encodingOptions).forWrite(isCompressed, isRendered), typesToWrite)
 		if err != nil {
 			return err
 		}
+		setCount++
 	}
 
-	// need to update frame count
+	if seekErr != nil {
+		return nil
+	}
+	return patchFrameSetCount(target, headerStart, setCount)
+}
 
-	return nil
+// overwrites FrameSetCount in the header starting at headerStart, leaving target positioned where it was
+func patchFrameSetCount(target io.WriteSeeker, headerStart int64, setCount uint64) error {
+	end, err := target.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = target.Seek(headerStart+frameSetCountOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(target, binary.LittleEndian, setCount)
+	if err != nil {
+		return err
+	}
+	_, err = target.Seek(end, io.SeekStart)
+	return err
 }
 
-func (sim *WorldSimulation) readHeader(source io.ReadSeeker) error {
+func (sim *WorldSimulation) readHeader(source io.Reader) error {
 	var err error
 	// read version
 	var version uint64
 	err = binary.Read(source, binary.LittleEndian, &version)
 	if err != nil {
 		return err
-	} else if version != WorldSimulationVersion {
+	} else if version < oldestWorldSimulationVersion || version > WorldSimulationVersion {
 		return IncompatibleVersion
 	}
-	// read header length
+	// read header length, of the fields following it
 	var length uint64
 	err = binary.Read(source, binary.LittleEndian, &length)
 	if err != nil {
 		return err
+	} else if length < fileHeaderMinimumLength {
+		return InvalidData
 	}
 	// read subdivisions
 	var subdivCount uint64
@@ -222,8 +482,7 @@ func (sim *WorldSimulation) readHeader(source io.ReadSeeker) error {
 	sim.subdivisions = int(subdivCount)
 	sim.subdivisionsSet = true
 	// read frame count
-	var frameCount uint64
-	err = binary.Read(source, binary.LittleEndian, &frameCount)
+	err = binary.Read(source, binary.LittleEndian, &sim.frameSetCountRead)
 	if err != nil {
 		return err
 	}
@@ -236,67 +495,161 @@ func (sim *WorldSimulation) readHeader(source io.ReadSeeker) error {
 		//log.Printf("Types written read as: %d", typesWritten)
 	}
 	sim.typesRead = typesWritten
+	length -= fileHeaderMinimumLength
+
+	// read metadata, if the version has it and the header is long enough to hold any
+	// fields past TypesBitField in older versions are unknown and skipped below
+	if version >= metadataWorldSimulationVersion && length >= 8 {
+		var metadataLength uint64
+		err = binary.Read(source, binary.LittleEndian, &metadataLength)
+		if err != nil {
+			return err
+		} else if metadataLength > length-8 {
+			return InvalidData
+		}
+		metadata, err := readMetadata(source, metadataLength)
+		if err != nil {
+			return err
+		}
+		if !sim.metadataSet {
+			sim.metadata = metadata
+		}
+		length -= 8 + metadataLength
+	}
+
+	// skip fields this version does not know
+	err = skipBytes(source, int64(length))
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func (sim *WorldSimulation) internalReadToWriter(source io.ReadSeeker, target io.Writer, setCount int, isCompressed, isRendered bool, typesToWrite uint64) error {
-	sim.source = source
-	sim.target = target
-	sim.isCompressed = isCompressed
-	sim.isRendered = isRendered
-	sim.typesToWrite = typesToWrite
+func internalReadWorldSimulation(seekSource io.ReadSeeker, typesToRead uint64) (WorldSimulation, error) {
+	var sim WorldSimulation
+	var source = probeSeeking(seekSource)
 
-	// start read
 	err := sim.readHeader(source)
 	if err != nil {
-		return err
+		return sim, err
 	}
-	// write our header
-	sim.writeHeader(target, typesToWrite)
 
-	// read sets and collect in requested size
-	var readFrames []Frame
-	var ok = true
-	for ok {
-		// read set
-		set, err := internalReadFrameSet(sim.source, sim.typesRead)
+	// read sets until the source runs out, the header count is not trusted as streamed files may not have updated it
+	for {
+		set, err := internalReadFrameSet(source, len(sim.frameSets), sim.typesRead, typesToRead)
 		if err == io.EOF {
-			ok = false // close loop after written
+			break
 		} else if err != nil {
-			log.Printf("Error reading next frame set: %s", err)
-			return err
-		} else {
-			readFrames = append(readFrames, set.Frames()...)
+			return sim, err
 		}
+		sim.frameSets = append(sim.frameSets, set)
+	}
+
+	return sim, nil
+}
+
+func (sim *WorldSimulation) internalReadToWriter(source io.Reader, target io.Writer, repack RepackOptions, isCompressed, isRendered bool, typesToWrite uint64) error {
+	if !repack.KeepGrouping && repack.SetCount <= 0 && repack.SetByteSize <= 0 {
+		return InvalidOptions
+	}
+
+	err := sim.internalOpenTranscode(source, target, isCompressed, isRendered, typesToWrite)
+	if err != nil {
+		return err
+	}
 
-		// write as many as possible
+	// the count is corrected at the end if possible, regrouping means the source count can't be used until then
+	var frameSetCount = UnknownFrameSetCount
+	if repack.KeepGrouping {
+		frameSetCount = sim.frameSetCountRead
+	}
+	err = sim.writeHeader(target, frameSetCount, typesToWrite)
+	if err != nil {
+		return err
+	}
+
+	if repack.KeepGrouping {
 		for {
-			remainingCount := len(readFrames)
-			// write fewer than set cound if no longer ok (EOF)
-			if remainingCount < setCount && ok {
-				break
+			err = sim.internalWriteNext()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
 			}
+		}
+	}
 
-			var writeSet FrameSet
+	// read sets and collect frames in the requested size
+	var pending FrameSet
+	// grouped by size, frames are encoded as they are added and written as encoded where their codec allows
+	var sized *sizedFrameSet
+	if repack.SetCount <= 0 {
+		sized, err = newSizedFrameSet(sim.encodingOptions.forWrite(sim.isCompressed, sim.isRendered), sim.typesToWrite)
+		if err != nil {
+			return err
+		}
+	}
+	for {
+		set, err := sim.readTranscodedSet()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
 
-			for i := 0; i < setCount && i < remainingCount; i++ {
-				writeSet.AddFrame(readFrames[i])
+		for _, frame := range set.Frames() {
+			if repack.SetCount > 0 {
+				pending.AddFrame(frame)
+				if len(pending.frames) < repack.SetCount {
+					continue
+				}
+				err = sim.writeTranscodedSet(&pending, nil)
+				if err != nil {
+					return err
+				}
+				pending = FrameSet{}
+				continue
 			}
 
-			err = writeSet.internalWrite(sim.target, sim.isCompressed, sim.isRendered, sim.typesToWrite)
+			// frames are differenced against the one before or the set's mean, so size each as it would be written in the set
+			frameSize, err := sized.add(frame)
 			if err != nil {
-				log.Printf("Error writing frame set")
+				return err
 			}
-
-			if ok {
-				readFrames = readFrames[setCount:] // TODO: will this discard frames during GC?
-			} else {
-				// break here if we are done
-				break
+			if len(sized.set.frames) == 1 || sized.size <= repack.SetByteSize {
+				continue
+			}
+			// the frame starts the next set, write the pending set first
+			sized.removeLast(frameSize)
+			err = sim.writeTranscodedSet(&sized.set, sized.encoded)
+			if err != nil {
+				return err
+			}
+			sized, err = newSizedFrameSet(sized.encoding, sim.typesToWrite)
+			if err != nil {
+				return err
+			}
+			_, err = sized.add(frame)
+			if err != nil {
+				return err
 			}
 		}
 	}
 
-	return nil
+	// write whatever is left
+	if len(pending.frames) > 0 {
+		err = sim.writeTranscodedSet(&pending, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if sized != nil && len(sized.set.frames) > 0 {
+		err = sim.writeTranscodedSet(&sized.set, sized.encoded)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sim.finishTranscode()
 }
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"bytes"
 	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
 	. "github.com/Smerom/WorldDataFormat"
 
 	. "github.com/onsi/ginkgo"
@@ -209,4 +212,545 @@ var _ = Describe("WorldSimulation", func() {
 	    })
 	})
 
+	Context("set options", func() {
+		It("should override the simulation's for that set only", func() {
+			var worldSim WorldSimulation
+			worldSim.SetSubdivisions(1)
+			worldSim.SetCompression(Compression{Codec: ZlibCodec, Level: 1})
+			for s := 0; s < 2; s++ {
+				var set FrameSet
+				if s == 0 {
+					set.SetChecksummed(true)
+					set.SetCompression(Compression{Codec: LZWCodec})
+				}
+				var elevations ElevationFrame
+				elevations.SetElevations([]float64{1, 2, 3})
+				set.AddFrame(Frame{Elevations: &elevations})
+				worldSim.AddFrameSet(set)
+			}
+			var data bytes.Buffer
+			Expect(worldSim.WriteRendered(&data, true, ElevationFrameFlag)).To(Succeed())
+
+			// storage flags of each set's frame, after its header and single offset, the first also has its block checksum
+			firstFlags := binary.LittleEndian.Uint64(data.Bytes()[40+40+12+8:])
+			secondSet := 40 + binary.LittleEndian.Uint64(data.Bytes()[40:])
+			secondFlags := binary.LittleEndian.Uint64(data.Bytes()[secondSet+40+8:])
+			Expect(firstFlags & CompressionCodecMask >> CompressionCodecShift).To(BeNumerically("==", LZWCodec))
+			Expect(firstFlags & HasChecksumFlag).ToNot(BeZero())
+			Expect(secondFlags & CompressionCodecMask >> CompressionCodecShift).To(BeNumerically("==", ZlibCodec))
+			Expect(secondFlags & HasChecksumFlag).To(BeZero())
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			for _, set := range readSim.FrameSets() {
+				Expect(set.Frames()[0].Elevations.RenderedElevations()).To(Equal([]int16{1, 2, 3}))
+			}
+		})
+	})
+
+	Context("stream write", func() {
+		It("should correct the frame set count in the header", func() {
+			file, err := ioutil.TempFile("", "worldSimulation")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			defer file.Close()
+
+			var worldSim WorldSimulation
+			worldSim.SetSubdivisions(2)
+			errChan := worldSim.StreamWriteRendered(file, false, AgeFrameFlag)
+			for s := 0; s < 3; s++ {
+				var set FrameSet
+				set.AddFrame(Frame{Age: &AgeFrame{Age: float64(s)}})
+				worldSim.AddFrameSet(set)
+			}
+			worldSim.FlushAndCloseWriteStream()
+			Expect(<-errChan).ToNot(HaveOccurred())
+
+			_, err = file.Seek(24, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+			var frameCount uint64
+			err = binary.Read(file, binary.LittleEndian, &frameCount)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frameCount).To(BeNumerically("==", 3))
+
+			_, err = file.Seek(0, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+			readSim, err := ReadWorldSimulation(file)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(readSim.FrameSets())).To(Equal(3))
+		})
+
+		It("should stream to a pipe with an unknown frame set count", func() {
+			reader, writer, err := os.Pipe()
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+			var received = make(chan []byte)
+			go func() {
+				data, _ := ioutil.ReadAll(reader)
+				received <- data
+			}()
+
+			var worldSim WorldSimulation
+			worldSim.SetSubdivisions(2)
+			errChan := worldSim.StreamWriteRendered(writer, false, AgeFrameFlag)
+			for s := 0; s < 3; s++ {
+				var set FrameSet
+				set.AddFrame(Frame{Age: &AgeFrame{Age: float64(s)}})
+				worldSim.AddFrameSet(set)
+			}
+			worldSim.FlushAndCloseWriteStream()
+			Expect(<-errChan).ToNot(HaveOccurred())
+			writer.Close()
+
+			data := <-received
+			Expect(binary.LittleEndian.Uint64(data[24:])).To(BeNumerically("==", UnknownFrameSetCount))
+			readSim, err := ReadWorldSimulation(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(readSim.FrameSets())).To(Equal(3))
+		})
+
+		It("should keep taking sets after a write error", func() {
+			file, err := ioutil.TempFile("", "worldSimulation")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			defer file.Close()
+
+			var worldSim WorldSimulation
+			worldSim.SetSubdivisions(2)
+			// the sets have no elevations to write
+			errChan := worldSim.StreamWriteRendered(file, false, AgeFrameFlag|ElevationFrameFlag)
+			for s := 0; s < 5; s++ {
+				var set FrameSet
+				set.AddFrame(Frame{Age: &AgeFrame{Age: float64(s)}})
+				worldSim.AddFrameSet(set)
+			}
+			worldSim.FlushAndCloseWriteStream()
+			Expect(<-errChan).To(Equal(MissingData))
+		})
+
+		It("should keep full elevations when streaming in Full mode", func() {
+			file, err := ioutil.TempFile("", "worldSimulation")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			defer file.Close()
+
+			var worldSim WorldSimulation
+			worldSim.SetSubdivisions(2)
+			errChan := worldSim.StreamWriteFull(file, true, ElevationFrameFlag)
+			for s := 0; s < 2; s++ {
+				var set FrameSet
+				var elevations ElevationFrame
+				elevations.SetElevations([]float64{float64(s) + 0.125, -1e-3, 9620.5})
+				set.AddFrame(Frame{Elevations: &elevations})
+				worldSim.AddFrameSet(set)
+			}
+			worldSim.FlushAndCloseWriteStream()
+			Expect(<-errChan).ToNot(HaveOccurred())
+
+			_, err = file.Seek(0, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+			readSim, err := ReadWorldSimulation(file)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(readSim.FrameSets())).To(Equal(2))
+			for s, set := range readSim.FrameSets() {
+				Expect(set.Frames()[0].Elevations.Elevations()).To(Equal([]float64{float64(s) + 0.125, -1e-3, 9620.5}))
+			}
+		})
+	})
+
+	Context("transcode", func() {
+		var data []byte
+
+		BeforeEach(func() {
+			var worldSim WorldSimulation
+			worldSim.SetSubdivisions(5)
+			for s := 0; s < 3; s++ {
+				var set FrameSet
+				for f := 0; f < 2; f++ {
+					var elevations ElevationFrame
+					elevations.SetElevations([]float64{float64(s), float64(f) + 0.5})
+					set.AddFrame(Frame{Age: &AgeFrame{Age: float64(s*2 + f)}, Elevations: &elevations})
+				}
+				worldSim.AddFrameSet(set)
+			}
+			var buf bytes.Buffer
+			err := worldSim.WriteFull(&buf, true, AgeFrameFlag|ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			data = buf.Bytes()
+		})
+
+		It("should write one frame set per WriteNext", func() {
+			var target bytes.Buffer
+			var transcoder WorldSimulation
+			err := transcoder.OpenTranscode(bytes.NewReader(data), &target, false, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			for s := 0; s < 3; s++ {
+				Expect(transcoder.WriteNext()).To(Succeed())
+
+				readSim, err := ReadWorldSimulation(bytes.NewReader(target.Bytes()))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(len(readSim.FrameSets())).To(Equal(s + 1))
+				Expect(readSim.TypesRead()).To(BeNumerically("==", ElevationFrameFlag))
+				for f, frame := range readSim.FrameSets()[s].Frames() {
+					Expect(frame.Age).To(BeNil())
+					Expect(frame.Elevations.RenderedElevations()).To(Equal([]int16{int16(s), int16(f)}))
+				}
+			}
+			Expect(transcoder.WriteNext()).To(Equal(io.EOF))
+			Expect(binary.LittleEndian.Uint64(target.Bytes()[24:])).To(BeNumerically("==", 3))
+		})
+
+		It("should return read errors", func() {
+			var target bytes.Buffer
+			var transcoder WorldSimulation
+			err := transcoder.OpenTranscode(bytes.NewReader(data[:len(data)-1]), &target, false, false, AgeFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(transcoder.WriteNext()).To(Succeed())
+			Expect(transcoder.WriteNext()).To(Succeed())
+			Expect(transcoder.WriteNext()).To(Equal(io.ErrUnexpectedEOF))
+		})
+
+		Context("repacking", func() {
+			var data []byte
+
+			BeforeEach(func() {
+				var worldSim WorldSimulation
+				worldSim.SetSubdivisions(5)
+				for s := 0; s < 2; s++ {
+					var set FrameSet
+					for f := 0; f < 5; f++ {
+						set.AddFrame(Frame{Age: &AgeFrame{Age: float64(s*5 + f)}})
+					}
+					worldSim.AddFrameSet(set)
+				}
+				var buf bytes.Buffer
+				err := worldSim.WriteFull(&buf, false, AgeFrameFlag)
+				Expect(err).ToNot(HaveOccurred())
+				data = buf.Bytes()
+			})
+
+			setSizes := func(repack RepackOptions) []int {
+				var target bytes.Buffer
+				var transcoder WorldSimulation
+				err := transcoder.RepackToWriter(bytes.NewReader(data), &target, repack, false, false, AgeFrameFlag)
+				Expect(err).ToNot(HaveOccurred())
+
+				readSim, err := ReadWorldSimulation(bytes.NewReader(target.Bytes()))
+				Expect(err).ToNot(HaveOccurred())
+				var sizes []int
+				var age float64
+				for _, set := range readSim.FrameSets() {
+					sizes = append(sizes, len(set.Frames()))
+					for _, frame := range set.Frames() {
+						Expect(frame.Age.Age).To(BeNumerically("==", age))
+						age++
+					}
+				}
+				return sizes
+			}
+
+			It("should group by frame count", func() {
+				Expect(setSizes(RepackOptions{SetCount: 4})).To(Equal([]int{4, 4, 2}))
+				Expect(setSizes(RepackOptions{SetCount: 5})).To(Equal([]int{5, 5}))
+			})
+
+			It("should group by byte size", func() {
+				Expect(setSizes(RepackOptions{SetByteSize: 24})).To(Equal([]int{3, 3, 3, 1}))
+				Expect(setSizes(RepackOptions{SetByteSize: 1})).To(Equal([]int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}))
+			})
+
+			It("should keep the original grouping", func() {
+				Expect(setSizes(RepackOptions{KeepGrouping: true, SetCount: 3})).To(Equal([]int{5, 5}))
+			})
+
+			It("should write an unknown frame set count when the target can't seek", func() {
+				var target bytes.Buffer
+				var transcoder WorldSimulation
+				err := transcoder.RepackToWriter(bytes.NewReader(data), &target, RepackOptions{SetCount: 3}, false, false, AgeFrameFlag)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(binary.LittleEndian.Uint64(target.Bytes()[24:])).To(BeNumerically("==", UnknownFrameSetCount))
+			})
+
+			It("should correct the frame set count when the target can seek", func() {
+				file, err := ioutil.TempFile("", "worldSimulation")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(file.Name())
+				defer file.Close()
+
+				var transcoder WorldSimulation
+				err = transcoder.RepackToWriter(bytes.NewReader(data), file, RepackOptions{SetCount: 3}, false, false, AgeFrameFlag)
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = file.Seek(24, io.SeekStart)
+				Expect(err).ToNot(HaveOccurred())
+				var frameCount uint64
+				err = binary.Read(file, binary.LittleEndian, &frameCount)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frameCount).To(BeNumerically("==", 4))
+			})
+
+			It("should return an error without a grouping", func() {
+				var target bytes.Buffer
+				var transcoder WorldSimulation
+				err := transcoder.RepackToWriter(bytes.NewReader(data), &target, RepackOptions{}, false, false, AgeFrameFlag)
+				Expect(err).To(Equal(InvalidOptions))
+			})
+
+			It("should return write errors", func() {
+				var target bytes.Buffer
+				var transcoder WorldSimulation
+				err := transcoder.RepackToWriter(bytes.NewReader(data), &target, RepackOptions{SetCount: 3}, false, false, AgeFrameFlag|ElevationFrameFlag)
+				Expect(err).To(Equal(MissingData))
+			})
+		})
+
+		Context("repacking by byte size", func() {
+			var data []byte
+
+			BeforeEach(func() {
+				// frames that change a little from one to the next, so their size depends on what they are differenced against
+				var worldSim WorldSimulation
+				worldSim.SetSubdivisions(1)
+				var set FrameSet
+				var elevations = make([]float64, 4000)
+				var temperatures = make([]float64, 4000)
+				var zeros = make([]float64, 4000)
+				var random uint32 = 1
+				for index := range elevations {
+					random = random*1103515245 + 12345
+					elevations[index] = float64((index*7919)%2000 - 1000)
+					temperatures[index] = float64((random>>16)%17) - 9
+				}
+				for f := 0; f < 8; f++ {
+					for index := f; index < len(elevations); index += 400 {
+						elevations[index] += 3
+						temperatures[index] = -temperatures[index]
+					}
+					var elevationFrame ElevationFrame
+					elevationFrame.SetElevations(append([]float64(nil), elevations...))
+					var satallite SatalliteFrame
+					satallite.SetColorsFromData(temperatures, zeros, zeros, nil)
+					set.AddFrame(Frame{Elevations: &elevationFrame, Satallite: &satallite})
+				}
+				worldSim.AddFrameSet(set)
+				var buf bytes.Buffer
+				Expect(worldSim.WriteFull(&buf, false, ElevationFrameFlag|SatalliteFrameFlag)).To(Succeed())
+				data = buf.Bytes()
+			})
+
+			repack := func(configure func(sim *WorldSimulation), repack RepackOptions, isRendered bool, typesToWrite uint64) []byte {
+				var target bytes.Buffer
+				var transcoder WorldSimulation
+				configure(&transcoder)
+				Expect(transcoder.RepackToWriter(bytes.NewReader(data), &target, repack, true, isRendered, typesToWrite)).To(Succeed())
+				return target.Bytes()
+			}
+
+			// bytes of frame data in the first set, after its header
+			firstSetDataSize := func(data []byte) int64 {
+				totalSize := binary.LittleEndian.Uint64(data[40:])
+				headerLength := binary.LittleEndian.Uint64(data[40+16:])
+				return int64(totalSize - 24 - headerLength)
+			}
+
+			frameCounts := func(data []byte) []int {
+				readSim, err := ReadWorldSimulation(bytes.NewReader(data))
+				Expect(err).ToNot(HaveOccurred())
+				var counts []int
+				for _, set := range readSim.FrameSets() {
+					counts = append(counts, len(set.Frames()))
+				}
+				return counts
+			}
+
+			var cases = []struct{
+				name string
+				configure func(sim *WorldSimulation)
+				isRendered bool
+				typesToWrite uint64
+			}{
+				{"full elevations", func(sim *WorldSimulation) {}, false, ElevationFrameFlag},
+				{"XOR encoded elevations", func(sim *WorldSimulation) { sim.SetXorEncoded(true) }, false, ElevationFrameFlag},
+				{"rendered elevations with key frames", func(sim *WorldSimulation) { sim.SetKeyFrameInterval(2) }, true, ElevationFrameFlag},
+				{"temporal diffed colors with key frames", func(sim *WorldSimulation) {
+					sim.SetTemporalDiffed(true)
+					sim.SetKeyFrameInterval(2)
+				}, false, SatalliteFrameFlag},
+			}
+			for _, c := range cases {
+				c := c
+
+				It(fmt.Sprintf("should size frames as they are written, %s", c.name), func() {
+					byCount := repack(c.configure, RepackOptions{SetCount: 4}, c.isRendered, c.typesToWrite)
+					bySize := repack(c.configure, RepackOptions{SetByteSize: firstSetDataSize(byCount)}, c.isRendered, c.typesToWrite)
+					Expect(frameCounts(bySize)).To(Equal([]int{4, 4}))
+					// the frames sized are written as encoded then, and must match those encoded with their set
+					Expect(bySize).To(Equal(byCount))
+				})
+			}
+
+			It("should count the mean of average diffed sets", func() {
+				configure := func(sim *WorldSimulation) { sim.SetAverageDiffed(true) }
+				byCount := repack(configure, RepackOptions{SetCount: 1}, true, ElevationFrameFlag)
+				bySize := repack(configure, RepackOptions{SetByteSize: firstSetDataSize(byCount)}, true, ElevationFrameFlag)
+				Expect(frameCounts(bySize)).To(Equal([]int{1, 1, 1, 1, 1, 1, 1, 1}))
+				Expect(bySize).To(Equal(byCount))
+
+				// with more frames to a set the mean follows the frames added
+				byCount = repack(configure, RepackOptions{SetCount: 3}, true, ElevationFrameFlag)
+				bySize = repack(configure, RepackOptions{SetByteSize: firstSetDataSize(byCount) * 11 / 10}, true, ElevationFrameFlag)
+				Expect(frameCounts(bySize)[0]).To(BeNumerically(">=", 3))
+				readSim, err := ReadWorldSimulation(bytes.NewReader(bySize))
+				Expect(err).ToNot(HaveOccurred())
+				expected, err := ReadWorldSimulation(bytes.NewReader(byCount))
+				Expect(err).ToNot(HaveOccurred())
+				var frames, expectedFrames []Frame
+				for _, set := range readSim.FrameSets() {
+					frames = append(frames, set.Frames()...)
+				}
+				for _, set := range expected.FrameSets() {
+					expectedFrames = append(expectedFrames, set.Frames()...)
+				}
+				Expect(len(frames)).To(Equal(len(expectedFrames)))
+				for f := range frames {
+					Expect(frames[f].Elevations.RenderedElevations()).To(Equal(expectedFrames[f].Elevations.RenderedElevations()))
+				}
+			})
+		})
+
+		It("should return an error from WriteNext if not opened", func() {
+			var transcoder WorldSimulation
+			Expect(transcoder.WriteNext()).To(Equal(NoSource))
+		})
+	})
+
+	Context("read", func() {
+		var worldSim WorldSimulation
+		var typesToWrite uint64
+		const subdivisions = 12
+
+		BeforeEach(func() {
+			worldSim = WorldSimulation{}
+			worldSim.SetSubdivisions(subdivisions)
+			typesToWrite = AgeFrameFlag
+
+			for s := 0; s < 3; s++ {
+				var set FrameSet
+				for f := 0; f < 4; f++ {
+					var frame Frame
+					frame.Age = &AgeFrame{Age: float64(s*4 + f)}
+					set.AddFrame(frame)
+				}
+				worldSim.AddFrameSet(set)
+			}
+		})
+
+		It("should return the frame sets written", func() {
+			var data bytes.Buffer
+			err := worldSim.WriteFull(&data, false, typesToWrite)
+			if err != nil {
+				Fail(fmt.Sprintf("World WriteFull error: %s", err))
+			}
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readSim.Subdivisions()).To(BeNumerically("==", subdivisions))
+			Expect(readSim.TypesRead()).To(BeNumerically("==", typesToWrite))
+			Expect(len(readSim.FrameSets())).To(Equal(3))
+			for s, set := range readSim.FrameSets() {
+				Expect(len(set.Frames())).To(Equal(4))
+				for f, frame := range set.Frames() {
+					Expect(frame.Age.Age).To(BeNumerically("==", s*4+f))
+				}
+			}
+		})
+
+		It("should rebuild rendered elevations differenced between frames", func() {
+			renderedSim := WorldSimulation{}
+			renderedSim.SetSubdivisions(subdivisions)
+			for s := 0; s < 3; s++ {
+				var set FrameSet
+				for f := 0; f < 4; f++ {
+					var elevations ElevationFrame
+					elevations.SetElevations([]float64{float64(s*400 + f*100), -float64(f * 7), 1000, float64(f)})
+					set.AddFrame(Frame{Elevations: &elevations})
+				}
+				renderedSim.AddFrameSet(set)
+			}
+
+			var data bytes.Buffer
+			err := renderedSim.WriteRendered(&data, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(readSim.FrameSets())).To(Equal(3))
+			for s, set := range readSim.FrameSets() {
+				for f, frame := range set.Frames() {
+					Expect(frame.Elevations.RenderedElevations()).To(Equal([]int16{int16(s*400 + f*100), -int16(f * 7), 1000, int16(f)}))
+				}
+			}
+
+			// regrouping on transcode has to re-difference frames moved to or from the start of a set
+			var transcoded bytes.Buffer
+			var transcoder WorldSimulation
+			err = transcoder.ReadToWriter(bytes.NewReader(data.Bytes()), &transcoded, true, true, ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			readSim, err = ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(readSim.FrameSets())).To(Equal(1))
+			for index, frame := range readSim.FrameSets()[0].Frames() {
+				s, f := index/4, index%4
+				Expect(frame.Elevations.RenderedElevations()).To(Equal([]int16{int16(s*400 + f*100), -int16(f * 7), 1000, int16(f)}))
+			}
+		})
+
+		It("should read only the requested frame types", func() {
+			for _, set := range worldSim.FrameSets() {
+				frames := set.Frames()
+				for f := range frames {
+					var elevations ElevationFrame
+					elevations.SetElevations([]float64{frames[f].Age.Age, 2 * frames[f].Age.Age})
+					frames[f].Elevations = &elevations
+				}
+			}
+			var data bytes.Buffer
+			err := worldSim.WriteRendered(&data, true, AgeFrameFlag|ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+
+			readSim, err := ReadWorldSimulationTypes(bytes.NewReader(data.Bytes()), ElevationFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(readSim.FrameSets())).To(Equal(3))
+			for s, set := range readSim.FrameSets() {
+				for f, frame := range set.Frames() {
+					Expect(frame.Age).To(BeNil())
+					Expect(frame.Elevations.RenderedElevations()).To(Equal([]int16{int16(s*4 + f), int16(2 * (s*4 + f))}))
+				}
+			}
+
+			readSim, err = ReadWorldSimulationTypes(bytes.NewReader(data.Bytes()), AgeFrameFlag)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(readSim.FrameSets())).To(Equal(3))
+			for s, set := range readSim.FrameSets() {
+				for f, frame := range set.Frames() {
+					Expect(frame.Elevations).To(BeNil())
+					Expect(frame.Age.Age).To(BeNumerically("==", s*4+f))
+				}
+			}
+		})
+
+		It("should return an error for a truncated file", func() {
+			var data bytes.Buffer
+			err := worldSim.WriteFull(&data, false, typesToWrite)
+			if err != nil {
+				Fail(fmt.Sprintf("World WriteFull error: %s", err))
+			}
+
+			_, err = ReadWorldSimulation(bytes.NewReader(data.Bytes()[:data.Len()-4]))
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
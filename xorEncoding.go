@@ -0,0 +1,144 @@
+package worldDataFormat
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Gorilla style packing of float64 bit patterns that have already been XORed
+// against a reference, see IsXorEncodedFlag. Stored as a uint64 value count followed by
+// one bit per value, 0 when the value is zero, otherwise 1 and then
+//   0 and the meaningful bits, when they fit in the window of the previous nonzero value
+//   1, 6 bits of leading zeros, 6 bits of meaningful bit count less one, and the meaningful bits
+// bits are written most significant first
+
+func xorPack(values []uint64) []byte {
+	var writer bitWriter
+	var countBytes [8]byte
+	binary.LittleEndian.PutUint64(countBytes[:], uint64(len(values)))
+	writer.data = append(writer.data, countBytes[:]...)
+
+	var windowLeading, windowTrailing = -1, 0
+	for _, value := range values {
+		if value == 0 {
+			writer.writeBits(0, 1)
+			continue
+		}
+		writer.writeBits(1, 1)
+		leading := bits.LeadingZeros64(value)
+		trailing := bits.TrailingZeros64(value)
+		if windowLeading >= 0 && leading >= windowLeading && trailing >= windowTrailing {
+			writer.writeBits(0, 1)
+			writer.writeBits(value>>uint(windowTrailing), 64-windowLeading-windowTrailing)
+			continue
+		}
+		meaningful := 64 - leading - trailing
+		writer.writeBits(1, 1)
+		writer.writeBits(uint64(leading), 6)
+		writer.writeBits(uint64(meaningful-1), 6)
+		writer.writeBits(value>>uint(trailing), meaningful)
+		windowLeading, windowTrailing = leading, trailing
+	}
+	return writer.data
+}
+
+func xorUnpack(data []byte) ([]uint64, error) {
+	if len(data) < 8 {
+		return nil, InvalidData
+	}
+	count := binary.LittleEndian.Uint64(data)
+	// every value takes at least one bit
+	if count > uint64(len(data)-8)*8 {
+		return nil, InvalidData
+	}
+	var reader = bitReader{data: data[8:]}
+	var values = make([]uint64, count)
+
+	var windowLeading, windowTrailing = -1, 0
+	for index := range values {
+		isNonzero, err := reader.readBits(1)
+		if err != nil {
+			return nil, err
+		}
+		if isNonzero == 0 {
+			continue
+		}
+		isNewWindow, err := reader.readBits(1)
+		if err != nil {
+			return nil, err
+		}
+		if isNewWindow == 1 {
+			leading, err := reader.readBits(6)
+			if err != nil {
+				return nil, err
+			}
+			meaningful, err := reader.readBits(6)
+			if err != nil {
+				return nil, err
+			}
+			meaningful++
+			if leading+meaningful > 64 {
+				return nil, InvalidData
+			}
+			windowLeading = int(leading)
+			windowTrailing = 64 - int(leading) - int(meaningful)
+		} else if windowLeading < 0 {
+			return nil, InvalidData
+		}
+		value, err := reader.readBits(64 - windowLeading - windowTrailing)
+		if err != nil {
+			return nil, err
+		}
+		values[index] = value << uint(windowTrailing)
+	}
+	return values, nil
+}
+
+type bitWriter struct {
+	data []byte
+	used uint // bits of the last byte in use
+}
+
+// writes the low count bits of value
+func (writer *bitWriter) writeBits(value uint64, count int) {
+	for count > 0 {
+		if writer.used == 0 || writer.used == 8 {
+			writer.data = append(writer.data, 0)
+			writer.used = 0
+		}
+		free := 8 - int(writer.used)
+		take := count
+		if take > free {
+			take = free
+		}
+		chunk := byte((value >> uint(count-take)) & (1<<uint(take) - 1))
+		writer.data[len(writer.data)-1] |= chunk << uint(free-take)
+		writer.used += uint(take)
+		count -= take
+	}
+}
+
+type bitReader struct {
+	data     []byte
+	position uint // in bits
+}
+
+func (reader *bitReader) readBits(count int) (uint64, error) {
+	if reader.position+uint(count) > uint(len(reader.data))*8 {
+		return 0, InvalidData
+	}
+	var value uint64
+	for count > 0 {
+		current := reader.data[reader.position/8]
+		available := 8 - int(reader.position%8)
+		take := count
+		if take > available {
+			take = available
+		}
+		chunk := uint64(current>>uint(available-take)) & (1<<uint(take) - 1)
+		value = value<<uint(take) | chunk
+		reader.position += uint(take)
+		count -= take
+	}
+	return value, nil
+}
@@ -0,0 +1,143 @@
+package worldDataFormat_test
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	. "github.com/Smerom/WorldDataFormat"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("XOR encoding", func() {
+	var values [][]float64
+
+	BeforeEach(func() {
+		values = [][]float64{
+			{1000.125, -0.0, math.Inf(1), math.NaN(), 5e-324, 1000.125, 1000.125, -3.5},
+			{1000.25, 0.0, math.Inf(-1), math.NaN(), 5e-324, 1000.125, 999.875, -3.5},
+			{1000.25, 0.0, math.MaxFloat64, 7, -5e-324, 0, 999.875, -3.75},
+		}
+	})
+
+	writeAndRead := func(configure func(sim *WorldSimulation), isCompressed bool) WorldSimulation {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		configure(&sim)
+		var set FrameSet
+		for _, frameValues := range values {
+			var elevations ElevationFrame
+			elevations.SetElevations(frameValues)
+			set.AddFrame(Frame{Elevations: &elevations})
+		}
+		sim.AddFrameSet(set)
+
+		var data bytes.Buffer
+		err := sim.WriteFull(&data, isCompressed, ElevationFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+
+		readSim, err := ReadWorldSimulation(bytes.NewReader(data.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		return readSim
+	}
+
+	// compared as bit patterns so NaN and negative zero must match exactly
+	expectBitExact := func(readSim WorldSimulation) {
+		frames := readSim.FrameSets()[0].Frames()
+		Expect(len(frames)).To(Equal(len(values)))
+		for f, frame := range frames {
+			Expect(frame.Elevations.Decode()).To(Succeed())
+			elevations := frame.Elevations.Elevations()
+			Expect(len(elevations)).To(Equal(len(values[f])))
+			for index, value := range elevations {
+				Expect(math.Float64bits(value)).To(Equal(math.Float64bits(values[f][index])))
+			}
+		}
+	}
+
+	for _, isCompressed := range []bool{false, true} {
+		isCompressed := isCompressed
+
+		It(fmt.Sprintf("should round trip bit exact, compressed: %t", isCompressed), func() {
+			expectBitExact(writeAndRead(func(sim *WorldSimulation) {
+				sim.SetXorEncoded(true)
+			}, isCompressed))
+		})
+
+		It(fmt.Sprintf("should round trip bit exact when self diffed, compressed: %t", isCompressed), func() {
+			expectBitExact(writeAndRead(func(sim *WorldSimulation) {
+				sim.SetXorEncoded(true)
+				sim.SetSelfDiffed(true)
+			}, isCompressed))
+		})
+
+		It(fmt.Sprintf("should round trip bit exact when average diffed, compressed: %t", isCompressed), func() {
+			expectBitExact(writeAndRead(func(sim *WorldSimulation) {
+				sim.SetXorEncoded(true)
+				sim.SetAverageDiffed(true)
+			}, isCompressed))
+		})
+	}
+
+	It("should round trip a frame of zeros", func() {
+		values = [][]float64{{0, 0, 0, 0}, {0, 0, 0, 0}}
+		expectBitExact(writeAndRead(func(sim *WorldSimulation) {
+			sim.SetXorEncoded(true)
+		}, false))
+	})
+
+	It("should be smaller than raw values for slowly changing frames", func() {
+		values = nil
+		for f := 0; f < 4; f++ {
+			var frameValues []float64
+			for index := 0; index < 1000; index++ {
+				frameValues = append(frameValues, 2000+float64(index%7)*0.5+float64(f)*0.25)
+			}
+			values = append(values, frameValues)
+		}
+
+		var sizes []int
+		for _, isXorEncoded := range []bool{false, true} {
+			var sim WorldSimulation
+			sim.SetSubdivisions(1)
+			sim.SetXorEncoded(isXorEncoded)
+			var set FrameSet
+			for _, frameValues := range values {
+				var elevations ElevationFrame
+				elevations.SetElevations(frameValues)
+				set.AddFrame(Frame{Elevations: &elevations})
+			}
+			sim.AddFrameSet(set)
+			var data bytes.Buffer
+			Expect(sim.WriteFull(&data, false, ElevationFrameFlag)).To(Succeed())
+			sizes = append(sizes, data.Len())
+		}
+		Expect(sizes[1] * 4).To(BeNumerically("<", sizes[0]))
+	})
+
+	It("should transcode to plain full frames", func() {
+		var sim WorldSimulation
+		sim.SetSubdivisions(1)
+		sim.SetXorEncoded(true)
+		var set FrameSet
+		for _, frameValues := range values {
+			var elevations ElevationFrame
+			elevations.SetElevations(frameValues)
+			set.AddFrame(Frame{Elevations: &elevations})
+		}
+		sim.AddFrameSet(set)
+		var data bytes.Buffer
+		Expect(sim.WriteFull(&data, true, ElevationFrameFlag)).To(Succeed())
+
+		var transcoded bytes.Buffer
+		var transcoder WorldSimulation
+		err := transcoder.ReadToWriter(bytes.NewReader(data.Bytes()), &transcoded, false, false, ElevationFrameFlag)
+		Expect(err).ToNot(HaveOccurred())
+
+		readSim, err := ReadWorldSimulation(bytes.NewReader(transcoded.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		expectBitExact(readSim)
+	})
+})